@@ -1,12 +1,41 @@
 package api
 
 import (
+	"fmt"
+	"time"
+
 	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
 )
 
 type Config struct {
 	Location      string         `yaml:"location"`
 	SampleConfigs []ConfigSample `yaml:"sampleConfigs"`
+	// DeviceFilter ignores frames of neighbouring heating systems; all frames are used when it's left empty
+	DeviceFilter DeviceFilterConfig `yaml:"deviceFilter,omitempty"`
+	// BatteryLowThreshold is the battery level in percent at or below which a warning gets logged, defaults to 20
+	BatteryLowThreshold float64 `yaml:"batteryLowThreshold,omitempty"`
+	// WindowOpenDropRate is the temperature drop in °C per hour at or above which a zone is flagged as having an open
+	// window, defaults to 4
+	WindowOpenDropRate float64 `yaml:"windowOpenDropRate,omitempty"`
+	// MaxAge is the default age like 30m above which a reading is too old to be used for a sample; left empty readings of
+	// any age are used, since values like the battery level or setpoint are only broadcast rarely or on change
+	MaxAge time.Duration `yaml:"maxAge,omitempty"`
+}
+
+// DeviceFilterConfig selects the devices that belong to the own heating system; devices used in sample configs are
+// always allowed
+type DeviceFilterConfig struct {
+	// device addresses like 13:106039 to allow
+	Allowlist []string `yaml:"allowlist,omitempty"`
+	// address of the own controller; devices exchanging frames with it are allowed
+	ControllerID string `yaml:"controllerID,omitempty"`
+	// lock onto the controller the configured thermostats talk to if no controller id is set
+	Learn bool `yaml:"learn,omitempty"`
+}
+
+// IsEnabled returns true if any of the filter settings is set
+func (dfc *DeviceFilterConfig) IsEnabled() bool {
+	return len(dfc.Allowlist) > 0 || dfc.ControllerID != "" || dfc.Learn
 }
 
 type ConfigSample struct {
@@ -19,17 +48,123 @@ type ConfigSample struct {
 
 	// alpha innotec specific config for sample
 	ValueMultiplier float64 `yaml:"valueMultiplier"`
-	ThermostatID    string  `yaml:"thermostatID"`
+	// device address like 34:092243, optionally followed by /<zone index in hex> for controllers reporting multiple zones,
+	// or uponor:110B:DE13 for an Uponor Smatrix Wave thermostat
+	ThermostatID string `yaml:"thermostatID"`
+	// decoded value of the thermostat to read, defaults to temperature
+	ValueType ValueType `yaml:"valueType"`
+	// age above which the reading is omitted from measurements, defaults to the max age of the config
+	MaxAge time.Duration `yaml:"maxAge,omitempty"`
+	// how the readings received since the previous measurement are combined into the measured value, defaults to last
+	Aggregation Aggregation `yaml:"aggregation,omitempty"`
+}
+
+// ValueType selects which decoded value of a thermostat is used for a sample
+type ValueType string
+
+const (
+	// ValueTypeTemperature is the measured zone temperature from opcode 30C9
+	ValueTypeTemperature ValueType = "temperature"
+	// ValueTypeSetpoint is the zone setpoint from opcode 2309
+	ValueTypeSetpoint ValueType = "setpoint"
+	// ValueTypeOverrideSetpoint is the zone setpoint from opcode 2349
+	ValueTypeOverrideSetpoint ValueType = "overrideSetpoint"
+	// ValueTypeOverrideMode is the zone mode from opcode 2349, 0 for following the schedule and 1 to 4 for overrides
+	ValueTypeOverrideMode ValueType = "overrideMode"
+	// ValueTypeHeatDemand is the zone heat demand in percent from opcode 3150
+	ValueTypeHeatDemand ValueType = "heatDemand"
+	// ValueTypeRelayDemand is the demand sent to a relay in percent from opcode 0008
+	ValueTypeRelayDemand ValueType = "relayDemand"
+	// ValueTypeActuatorState is the modulation level of a relay or actuator in percent from opcode 3EF0
+	ValueTypeActuatorState ValueType = "actuatorState"
+	// ValueTypeRSSI is the moving average of the signal strength of all frames received from the device
+	ValueTypeRSSI ValueType = "rssi"
+	// ValueTypeMissedBroadcasts is the estimated number of broadcasts from the device that didn't arrive
+	ValueTypeMissedBroadcasts ValueType = "missedBroadcasts"
+	// ValueTypeBatteryLevel is the battery level in percent from opcode 1060
+	ValueTypeBatteryLevel ValueType = "batteryLevel"
+	// ValueTypeBatteryLow is 1 when the device reports its battery as low in opcode 1060 and 0 otherwise
+	ValueTypeBatteryLow ValueType = "batteryLow"
+	// ValueTypeActiveFaults is the number of faults in the fault log of a controller from opcode 0418 that aren't
+	// restored yet
+	ValueTypeActiveFaults ValueType = "activeFaults"
+	// ValueTypeWindowOpen is 1 when a zone has an open window and 0 otherwise, either as reported with opcode 12B0 or
+	// detected from a fast drop of the temperature from opcode 30C9
+	ValueTypeWindowOpen ValueType = "windowOpen"
+	// ValueTypeFloorTemperature is the temperature of the floor sensor of an Uponor Smatrix Wave thermostat
+	ValueTypeFloorTemperature ValueType = "floorTemperature"
+	// ValueTypeHumidity is the relative humidity in percent measured by an Uponor Smatrix Wave T-169 thermostat
+	ValueTypeHumidity ValueType = "humidity"
+)
+
+// Aggregation selects how the readings within a measurement window are combined into a single sample value; it applies
+// to the values decoded from frames, while radio statistics and window state always use the last value; the pulse source
+// only supports last. Without zone index in the thermostat id only the zone with the latest reading is aggregated, and
+// windows with more than the 100 readings kept per zone and value type are skipped instead of aggregated partially
+type Aggregation string
+
+const (
+	// AggregationLast uses the most recent reading
+	AggregationLast Aggregation = "last"
+	// AggregationMean is the average of the readings
+	AggregationMean Aggregation = "mean"
+	// AggregationMin is the lowest reading
+	AggregationMin Aggregation = "min"
+	// AggregationMax is the highest reading
+	AggregationMax Aggregation = "max"
+	// AggregationCount is the number of readings
+	AggregationCount Aggregation = "count"
+	// AggregationTimeWeightedMean is the average of the readings weighted by how long each of them was the current
+	// value, so a burst of broadcasts doesn't outweigh a long steady period
+	AggregationTimeWeightedMean Aggregation = "timeWeightedMean"
+)
+
+// Aggregations lists the supported aggregations
+var Aggregations = []Aggregation{AggregationLast, AggregationMean, AggregationMin, AggregationMax, AggregationCount, AggregationTimeWeightedMean}
+
+// IsValid returns true if the aggregation is one of the supported aggregations
+func (a Aggregation) IsValid() bool {
+	for _, aggregation := range Aggregations {
+		if a == aggregation {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Config) SetDefaults() {
+	if c.BatteryLowThreshold == 0 {
+		c.BatteryLowThreshold = 20
+	}
+	if c.WindowOpenDropRate == 0 {
+		c.WindowOpenDropRate = 4
+	}
+	for i := range c.SampleConfigs {
+		c.SampleConfigs[i].SetDefaults()
+		if c.SampleConfigs[i].MaxAge == 0 {
+			c.SampleConfigs[i].MaxAge = c.MaxAge
+		}
+	}
+}
+
+// Validate returns an error for settings that would otherwise only fail once measurements get taken
+func (c *Config) Validate() error {
 	for _, sc := range c.SampleConfigs {
-		sc.SetDefaults()
+		if !sc.Aggregation.IsValid() {
+			return fmt.Errorf("Sample %v of thermostat %v has unknown aggregation %q, use one of %v", sc.SampleName, sc.ThermostatID, sc.Aggregation, Aggregations)
+		}
 	}
+	return nil
 }
 
 func (sc *ConfigSample) SetDefaults() {
 	if sc.ValueMultiplier == 0 {
 		sc.ValueMultiplier = 1
 	}
+	if sc.ValueType == "" {
+		sc.ValueType = ValueTypeTemperature
+	}
+	if sc.Aggregation == "" {
+		sc.Aggregation = AggregationLast
+	}
 }
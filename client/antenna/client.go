@@ -2,84 +2,583 @@ package antenna
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"regexp"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
 	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
-	foundation "github.com/estafette/estafette-foundation"
-	"github.com/jacobsa/go-serial/serial"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/state"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
-// Client is the interface for connecting to a websocket device via ethernet
+// Client is the interface for listening to the 868MHz RF antenna
 type Client interface {
-	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, err error)
+	Listen(ctx context.Context) (err error)
+	Status() <-chan Status
+	GetStatistics() Statistics
+	GetDevices() []Device
+	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error)
 	GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error)
+	State() state.Client
+	Request(ctx context.Context, destination protocol.Address, opcode protocol.Opcode, payload []byte) (reply *protocol.Frame, err error)
+	SetZoneSetpoint(ctx context.Context, controller protocol.Address, zoneIndex int, setpoint float64) (err error)
+	SetSystemMode(ctx context.Context, controller protocol.Address, mode protocol.SystemMode, until *time.Time) (err error)
 }
 
-// NewClient returns new websocket.Client
-func NewClient(antennaUSBDevicePath string, waitGroup *sync.WaitGroup, done chan struct{}) (Client, error) {
-	if antennaUSBDevicePath == "" {
-		return nil, fmt.Errorf("Please set the usb device path for the antenna")
+// Status is published whenever the connection to the antenna opens or closes
+type Status struct {
+	Connected bool
+	Err       error
+	Time      time.Time
+}
+
+// Statistics are counters describing how well the antenna is receiving
+type Statistics struct {
+	Connected           bool
+	LastReceivedMessage time.Time
+	LastValidFrame      time.Time
+	FramesReceived      map[protocol.Opcode]uint64
+	ParseFailures       uint64
+	ForeignFrames       uint64
+	ConnectionResets    uint64
+	// StaleSamples counts the samples omitted from measurements because their reading was older than the max age
+	StaleSamples uint64
+	// QuietThermostats lists the thermostats whose samples were omitted from the last measurement for being stale
+	QuietThermostats []string
+}
+
+// Device describes a device the antenna received valid frames from
+type Device struct {
+	Address   protocol.Address
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Frames    uint64
+	Opcodes   map[protocol.Opcode]uint64
+	// ValueTypes lists the decoded values per zone index that are currently available
+	ValueTypes map[int][]apiv1.ValueType
+	RSSI       RSSIStatistics
+	// MaxBroadcastInterval is the longest time between two broadcasts of the same opcode
+	MaxBroadcastInterval time.Duration
+	// MissedBroadcasts estimates the broadcasts that didn't arrive from gaps much longer than the usual interval
+	MissedBroadcasts uint64
+	// Battery is the last battery state reported by the device, nil if it never sent one
+	Battery *protocol.BatteryState
+	// Faults holds the fault log entries of a controller by log index
+	Faults map[int]protocol.FaultLogEntry
+}
+
+// RSSIStatistics describes the signal strength as reported by the antenna for received frames
+type RSSIStatistics struct {
+	Last    int
+	Min     int
+	Max     int
+	Average float64
+}
+
+const (
+	// weight of the newest value in the moving averages of rssi and broadcast intervals
+	rssiSmoothing     = 0.1
+	intervalSmoothing = 0.2
+	// a gap is counted as missed broadcasts once it's this many times longer than the average interval, which is only
+	// trusted after a couple of intervals
+	missedIntervalFactor   = 1.5
+	minIntervalsForMissing = 3
+
+	// requests are sent one at a time and retried when no reply arrives in time
+	commandQueueSize = 32
+	commandTimeout   = 2 * time.Second
+	commandAttempts  = 3
+
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+	silenceTimeout      = 2 * time.Minute
+
+	// number of readings kept per device, zone and value type
+	historySize = 100
+
+	// a low battery is logged at most once per interval per device
+	batteryWarningInterval = 24 * time.Hour
+
+	// open windows are detected from temperature drops within the lookback, ignoring drops smaller than the minimum
+	// as these are within the noise of a thermostat
+	windowOpenLookback = 15 * time.Minute
+	minWindowOpenDrop  = 0.5
+)
+
+// NewClient returns new antenna.Client; recorder and filter are optional and can be nil
+func NewClient(transport Transport, recorder Recorder, filter DeviceFilter) (Client, error) {
+	if transport == nil {
+		return nil, fmt.Errorf("Please set the transport for the antenna")
+	}
+
+	stateClient, err := state.NewClient(historySize)
+	if err != nil {
+		return nil, err
 	}
 
 	return &client{
-		antennaUSBDevicePath: antennaUSBDevicePath,
-		waitGroup:            waitGroup,
-		lastReceivedMessage:  time.Now().UTC(),
-		done:                 done,
+		transport:           transport,
+		recorder:            recorder,
+		filter:              filter,
+		minReconnectBackoff: minReconnectBackoff,
+		maxReconnectBackoff: maxReconnectBackoff,
+		silenceTimeout:      silenceTimeout,
+		commandTimeout:      commandTimeout,
+		commandAttempts:     commandAttempts,
+		commands:            make(chan *command, commandQueueSize),
+		status:              make(chan Status, 10),
+		lastReceivedMessage: time.Now().UTC(),
+		framesReceived:      map[protocol.Opcode]uint64{},
+		state:               stateClient,
+		devices:             map[protocol.Address]*Device{},
+		broadcastTimings:    map[broadcastKey]*broadcastTiming{},
+		batteryWarnings:     map[protocol.Address]time.Time{},
+		now:                 func() time.Time { return time.Now().UTC() },
 	}, nil
 }
 
 type client struct {
-	antennaUSBDevicePath string
-	waitGroup            *sync.WaitGroup
+	transport           Transport
+	recorder            Recorder
+	filter              DeviceFilter
+	minReconnectBackoff time.Duration
+	maxReconnectBackoff time.Duration
+	silenceTimeout      time.Duration
+	commandTimeout      time.Duration
+	commandAttempts     int
+	commands            chan *command
+	status              chan Status
+
+	// pendingMutex guards the request that is waiting for its reply
+	pendingMutex sync.Mutex
+	pending      *command
 
-	f                   io.ReadWriteCloser
-	in                  *bufio.Reader
-	responseChannel     chan []byte
+	// connectionMutex guards the open connection, the time of the last received line and the statistics
+	connectionMutex     sync.RWMutex
+	connection          io.ReadWriteCloser
+	connected           bool
 	lastReceivedMessage time.Time
-	done                chan struct{}
-	teardown            bool
+	lastValidFrame      time.Time
+	framesReceived      map[protocol.Opcode]uint64
+	parseFailures       uint64
+	foreignFrames       uint64
+	connectionResets    uint64
+
+	state state.Client
+
+	devicesMutex     sync.RWMutex
+	devices          map[protocol.Address]*Device
+	broadcastTimings map[broadcastKey]*broadcastTiming
+	batteryWarnings  map[protocol.Address]time.Time
+
+	staleTracker StaleTracker
+
+	// measurementMutex guards the time of the previous measurement, which starts the window aggregated samples cover
+	measurementMutex sync.Mutex
+	lastMeasurement  time.Time
+
+	// now returns the wall clock time, except when replaying
+	now func() time.Time
+}
+
+// command is a queued frame waiting to be sent and answered by a frame that matches; it's dropped once the context of
+// the caller is done
+type command struct {
+	ctx    context.Context
+	frame  *protocol.Frame
+	match  func(frame *protocol.Frame) bool
+	reply  chan *protocol.Frame
+	result chan commandResult
+	// confirm keeps waiting for the matching frame after the last attempt until the context of the caller is done
+	confirm bool
+}
+
+type commandResult struct {
+	reply *protocol.Frame
+	err   error
+}
+
+// broadcastKey identifies the periodic broadcasts of a single opcode by a device
+type broadcastKey struct {
+	address protocol.Address
+	opcode  protocol.Opcode
+}
+
+type broadcastTiming struct {
+	lastTime        time.Time
+	intervals       int
+	averageInterval time.Duration
+}
+
+// Listen keeps reading lines from the antenna until the context is cancelled; when opening the connection fails, reading
+// fails or the antenna stays silent for too long it reconnects with exponential backoff
+func (c *client) Listen(ctx context.Context) (err error) {
+
+	log.Info().Msgf("Starting antenna listener on %v...", c.transport)
+
+	defer close(c.status)
+	if c.recorder != nil {
+		defer c.recorder.Close()
+	}
+
+	senderDone := make(chan struct{})
+	defer func() { <-senderDone }()
+	go func() {
+		defer close(senderDone)
+		c.sendCommands(ctx)
+	}()
+
+	backoff := c.minReconnectBackoff
+	for {
+		connection, err := c.transport.Open()
+		if err == nil {
+			c.publishStatus(true, nil)
+			backoff = c.minReconnectBackoff
+
+			err = c.readLines(ctx, connection)
+		}
+
+		if ctx.Err() != nil {
+			c.connectionMutex.Lock()
+			c.connected = false
+			c.connectionMutex.Unlock()
+
+			log.Info().Msg("Received cancellation, stopped antenna listener")
+			return nil
+		}
+
+		log.Warn().Err(err).Msgf("Antenna connection on %v failed, reconnecting in %v...", c.transport, backoff)
+		c.publishStatus(false, err)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Received cancellation, stopped antenna listener")
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.maxReconnectBackoff {
+			backoff = c.maxReconnectBackoff
+		}
+	}
+}
+
+// Request queues an RQ frame for the destination and waits for the RP reply with the same opcode from that device,
+// retrying when it doesn't arrive in time; Listen has to run for requests to get sent
+func (c *client) Request(ctx context.Context, destination protocol.Address, opcode protocol.Opcode, payload []byte) (reply *protocol.Frame, err error) {
+	frame := protocol.NewFrame(protocol.VerbRequest, destination, opcode, payload)
+
+	return c.send(ctx, frame, false, func(reply *protocol.Frame) bool {
+		return reply.Verb == protocol.VerbReply && reply.Opcode == opcode && reply.Source() == destination
+	})
+}
+
+// SetZoneSetpoint writes a new setpoint for a zone to the controller and waits until the controller broadcasts it or the
+// context is done, retrying the write when the broadcast doesn't arrive in time
+func (c *client) SetZoneSetpoint(ctx context.Context, controller protocol.Address, zoneIndex int, setpoint float64) (err error) {
+	payload, err := protocol.EncodeZoneSetpoint(zoneIndex, setpoint)
+	if err != nil {
+		return err
+	}
+
+	frame := protocol.NewFrame(protocol.VerbWrite, controller, protocol.OpcodeZoneSetpoint, payload)
+	_, err = c.send(ctx, frame, true, func(broadcast *protocol.Frame) bool {
+		if broadcast.Verb != protocol.VerbInformation || broadcast.Opcode != protocol.OpcodeZoneSetpoint || broadcast.Source() != controller {
+			return false
+		}
+		setpoints, err := protocol.DecodeZoneSetpoints(broadcast)
+		if err != nil {
+			return false
+		}
+		for _, s := range setpoints {
+			if s.ZoneIndex == zoneIndex && s.Available && math.Abs(s.Setpoint-setpoint) < 0.005 {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("Failed setting setpoint of zone %02X on %v to %v: %w", zoneIndex, controller, setpoint, err)
+	}
+
+	return nil
 }
 
-func (c *client) GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, err error) {
+// SetSystemMode writes a new system mode to the controller and waits until the controller broadcasts it or the context
+// is done, retrying the write when the broadcast doesn't arrive in time; the mode is permanent if until is nil
+func (c *client) SetSystemMode(ctx context.Context, controller protocol.Address, mode protocol.SystemMode, until *time.Time) (err error) {
+	frame := protocol.NewFrame(protocol.VerbWrite, controller, protocol.OpcodeSystemMode, protocol.EncodeSystemMode(mode, until))
+	_, err = c.send(ctx, frame, true, func(broadcast *protocol.Frame) bool {
+		if broadcast.Verb != protocol.VerbInformation || broadcast.Opcode != protocol.OpcodeSystemMode || broadcast.Source() != controller {
+			return false
+		}
+		state, err := protocol.DecodeSystemMode(broadcast)
+		return err == nil && state.Mode == mode
+	})
+	if err != nil {
+		return fmt.Errorf("Failed setting system mode on %v to %v: %w", controller, mode, err)
+	}
 
-	log.Info().Msg("Starting retrieval of measurement...")
+	return nil
+}
 
-	c.openSerialPort()
-	defer c.closeSerialPort()
-	go c.keepSerialPortAlive()
+// send queues a frame and waits for the first received frame that matches; with confirm it keeps waiting after the
+// last attempt for as long as the context allows
+func (c *client) send(ctx context.Context, frame *protocol.Frame, confirm bool, match func(frame *protocol.Frame) bool) (reply *protocol.Frame, err error) {
+	cmd := &command{
+		ctx:     ctx,
+		frame:   frame,
+		confirm: confirm,
+		match:   match,
+		reply:   make(chan *protocol.Frame, 1),
+		result:  make(chan commandResult, 1),
+	}
 
-	c.responseChannel = make(chan []byte)
-	go c.receiveResponse()
+	select {
+	case c.commands <- cmd:
+	default:
+		return nil, fmt.Errorf("Command queue is full, dropped %v", cmd.frame.Raw)
+	}
 
-	<-c.done
-	log.Info().Msg("Received done signal, tearing down serial port listener")
-	c.waitGroup.Add(1)
-	defer c.waitGroup.Done()
-	c.teardown = true
+	select {
+	case result := <-cmd.result:
+		return result.reply, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// sendCommands transmits the queued frames one at a time until the context is cancelled
+func (c *client) sendCommands(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cmd := <-c.commands:
+			if cmd.ctx.Err() != nil {
+				// the caller gave up while the command was queued, so it's never written
+				cmd.result <- commandResult{err: cmd.ctx.Err()}
+				continue
+			}
+			reply, err := c.sendCommand(ctx, cmd)
+			cmd.result <- commandResult{reply: reply, err: err}
+		}
+	}
+}
 
-	// measurement = contractsv1.Measurement{
-	// 	ID:             uuid.New().String(),
-	// 	Source:         "jarvis-uponor-smatrix-exporter",
-	// 	Location:       config.Location,
-	// 	Samples:        []*contractsv1.Sample{},
-	// 	MeasuredAtTime: time.Now().UTC(),
-	// }
+// sendCommand writes a frame to the antenna and waits for its reply, retrying on write failures and timeouts; a command
+// to confirm waits for its reply after the last attempt until its context is done, since a controller broadcasts a
+// change on its own schedule
+func (c *client) sendCommand(ctx context.Context, cmd *command) (reply *protocol.Frame, err error) {
+	c.pendingMutex.Lock()
+	c.pending = cmd
+	c.pendingMutex.Unlock()
 
-	// for _, sc := range config.SampleConfigs {
-	// 	sample, sampleErr := c.GetSample(config, sc)
-	// 	if sampleErr != nil {
-	// 		return measurement, sampleErr
-	// 	}
-	// 	measurement.Samples = append(measurement.Samples, &sample)
-	// }
+	defer func() {
+		c.pendingMutex.Lock()
+		c.pending = nil
+		c.pendingMutex.Unlock()
+	}()
+
+	for attempt := 1; attempt <= c.commandAttempts; attempt++ {
+		if cmd.ctx.Err() != nil {
+			return nil, cmd.ctx.Err()
+		}
+
+		writeErr := c.writeLine(cmd.frame.Raw)
+		if writeErr != nil {
+			err = writeErr
+			log.Debug().Err(writeErr).Msgf("Failed sending %v, attempt %v of %v", cmd.frame.Raw, attempt, c.commandAttempts)
+		} else {
+			err = fmt.Errorf("No reply to %v within %v", cmd.frame.Raw, c.commandTimeout)
+		}
+
+		timeout := time.After(c.commandTimeout)
+		if cmd.confirm && attempt == c.commandAttempts {
+			timeout = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cmd.ctx.Done():
+			return nil, cmd.ctx.Err()
+		case reply := <-cmd.reply:
+			return reply, nil
+		case <-timeout:
+		}
+	}
+
+	return nil, fmt.Errorf("Sending failed after %v attempts: %w", c.commandAttempts, err)
+}
+
+// writeLine transmits a line through the open antenna connection
+func (c *client) writeLine(line string) error {
+	c.connectionMutex.Lock()
+	defer c.connectionMutex.Unlock()
+
+	if c.connection == nil {
+		return fmt.Errorf("Antenna is not connected")
+	}
+
+	_, err := c.connection.Write([]byte(line + "\r\n"))
+	if err != nil {
+		return fmt.Errorf("Failed writing to antenna: %w", err)
+	}
+
+	return nil
+}
+
+// matchReply hands a received frame to the pending command if it answers it
+func (c *client) matchReply(frame *protocol.Frame) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	if c.pending == nil || !c.pending.match(frame) {
+		return
+	}
+
+	select {
+	case c.pending.reply <- frame:
+	default:
+	}
+}
+
+// State returns the store with all decoded values and their history
+func (c *client) State() state.Client {
+	return c.state
+}
+
+func (c *client) Status() <-chan Status {
+	return c.status
+}
+
+func (c *client) GetStatistics() Statistics {
+	c.connectionMutex.RLock()
+	defer c.connectionMutex.RUnlock()
+
+	statistics := Statistics{
+		Connected:           c.connected,
+		LastReceivedMessage: c.lastReceivedMessage,
+		LastValidFrame:      c.lastValidFrame,
+		FramesReceived:      map[protocol.Opcode]uint64{},
+		ParseFailures:       c.parseFailures,
+		ForeignFrames:       c.foreignFrames,
+		ConnectionResets:    c.connectionResets,
+		StaleSamples:        c.staleTracker.StaleSamples(),
+		QuietThermostats:    c.staleTracker.QuietThermostats(),
+	}
+	for opcode, count := range c.framesReceived {
+		statistics.FramesReceived[opcode] = count
+	}
+
+	return statistics
+}
+
+// GetDevices returns every device received so far, ordered by address
+func (c *client) GetDevices() []Device {
+	c.devicesMutex.RLock()
+	devices := make([]Device, 0, len(c.devices))
+	indexes := map[protocol.Address]int{}
+	for _, d := range c.devices {
+		indexes[d.Address] = len(devices)
+		device := *d
+		device.Opcodes = map[protocol.Opcode]uint64{}
+		for opcode, count := range d.Opcodes {
+			device.Opcodes[opcode] = count
+		}
+		device.ValueTypes = map[int][]apiv1.ValueType{}
+		if d.Battery != nil {
+			battery := *d.Battery
+			device.Battery = &battery
+		}
+		if d.Faults != nil {
+			device.Faults = map[int]protocol.FaultLogEntry{}
+			for logIndex, entry := range d.Faults {
+				device.Faults[logIndex] = entry
+			}
+		}
+		devices = append(devices, device)
+	}
+	c.devicesMutex.RUnlock()
+
+	// keys are ordered by value type within a zone
+	for _, k := range c.state.Keys() {
+		if i, ok := indexes[k.Address]; ok {
+			devices[i].ValueTypes[k.ZoneIndex] = append(devices[i].ValueTypes[k.ZoneIndex], k.ValueType)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Address < devices[j].Address })
+
+	return devices
+}
+
+// publishStatus sends a status without blocking the listener if nobody reads the channel
+func (c *client) publishStatus(connected bool, err error) {
+	c.connectionMutex.Lock()
+	if c.connected && !connected {
+		c.connectionResets++
+	}
+	c.connected = connected
+	c.connectionMutex.Unlock()
+
+	select {
+	case c.status <- Status{Connected: connected, Err: err, Time: time.Now().UTC()}:
+	default:
+	}
+}
+
+// GetMeasurement returns the samples that have a value, together with the config each of them got read for
+func (c *client) GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error) {
+
+	log.Info().Msg("Taking measurement from latest received values...")
+
+	measurement = contractsv1.Measurement{
+		ID:             uuid.New().String(),
+		Source:         "jarvis-uponor-smatrix-exporter",
+		Location:       config.Location,
+		Samples:        []*contractsv1.Sample{},
+		MeasuredAtTime: c.now(),
+	}
+
+	c.measurementMutex.Lock()
+	windowStart := c.lastMeasurement
+	c.lastMeasurement = measurement.MeasuredAtTime
+	c.measurementMutex.Unlock()
+
+	c.warnLowBatteries(config.BatteryLowThreshold)
+
+	for _, sc := range config.SampleConfigs {
+		sample, sampleErr := c.GetSample(config, sc)
+		if c.staleTracker.Update(sc.ThermostatID, sc.ValueType, sampleErr) {
+			// a dead thermostat would otherwise show up as a flat line
+			continue
+		}
+		if sampleErr != nil {
+			// a thermostat might not have broadcast its value yet, so skip it instead of failing the entire measurement
+			log.Warn().Err(sampleErr).Msgf("Skipping sample %v for %v", sc.SampleName, sc.ThermostatID)
+			continue
+		}
+		sampleErr = c.aggregateSample(&sample, sc, windowStart, measurement.MeasuredAtTime)
+		if sampleErr != nil {
+			log.Warn().Err(sampleErr).Msgf("Skipping sample %v for %v", sc.SampleName, sc.ThermostatID)
+			continue
+		}
+		measurement.Samples = append(measurement.Samples, &sample)
+		sampleConfigs = append(sampleConfigs, sc)
+	}
+	c.staleTracker.UpdateQuiet()
 
 	return
 }
@@ -95,110 +594,629 @@ func (c *client) GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample)
 		MetricType: sampleConfig.MetricType,
 	}
 
-	// convert sample to float and correct
-	// sample.Value = value * sampleConfig.ValueMultiplier
+	var value float64
+	var receivedTime time.Time
+	if sampleConfig.ValueType == apiv1.ValueTypeWindowOpen {
+		value, receivedTime, err = c.getWindowOpen(sampleConfig.ThermostatID, config.WindowOpenDropRate)
+	} else {
+		value, receivedTime, err = c.getReading(sampleConfig.ThermostatID, sampleConfig.ValueType)
+	}
+	if err != nil {
+		return
+	}
+
+	err = CheckAge(config, sampleConfig, receivedTime, c.now())
+	if err != nil {
+		return
+	}
+
+	// correct value
+	sample.Value = value * sampleConfig.ValueMultiplier
 
 	return
 }
 
-func (c *client) openSerialPort() {
-	options := serial.OpenOptions{
-		PortName:               c.antennaUSBDevicePath,
-		BaudRate:               16550,
-		DataBits:               8,
-		StopBits:               1,
-		MinimumReadSize:        0,
-		InterCharacterTimeout:  2000,
-		ParityMode:             serial.PARITY_NONE,
-		Rs485Enable:            false,
-		Rs485RtsHighDuringSend: false,
-		Rs485RtsHighAfterSend:  false,
+// aggregateSample replaces the value of the sample by the aggregation of the readings received in the window from
+// start to end; without previous measurement the window covers the entire history
+func (c *client) aggregateSample(sample *contractsv1.Sample, sampleConfig apiv1.ConfigSample, start, end time.Time) (err error) {
+	switch sampleConfig.Aggregation {
+	case "", apiv1.AggregationLast:
+		return nil
+	}
+	switch sampleConfig.ValueType {
+	case apiv1.ValueTypeRSSI, apiv1.ValueTypeMissedBroadcasts, apiv1.ValueTypeActiveFaults, apiv1.ValueTypeWindowOpen:
+		return nil
+	}
+
+	address, zoneIndex, err := parseThermostatID(sampleConfig.ThermostatID)
+	if err != nil {
+		return
+	}
+
+	// without zone index only the zone getReading picks gets aggregated, since combining the zones of a controller would
+	// mix up different rooms
+	if zoneIndex < 0 {
+		latestKey, _, ok := c.state.Latest(address, zoneIndex, sampleConfig.ValueType)
+		if !ok {
+			return fmt.Errorf("No %v reading available for thermostat %v", sampleConfig.ValueType, sampleConfig.ThermostatID)
+		}
+		zoneIndex = latestKey.ZoneIndex
+	}
+
+	// readings of a value the device since reported as unavailable still count for the window they were received in
+	history := c.state.ZoneHistory(address, zoneIndex, sampleConfig.ValueType, time.Time{})
+	if len(history) >= historySize && history[0].ReceivedTime.After(start) {
+		return fmt.Errorf("The %v readings kept for thermostat %v don't cover the window since %v, please shorten the measurement interval", historySize, sampleConfig.ThermostatID, start)
 	}
 
-	f, err := serial.Open(options)
+	value, err := state.Aggregate(sampleConfig.Aggregation, history, start, end)
 	if err != nil {
-		log.Fatal().Err(err).Interface("options", options).Msg("Failed opening serial device")
+		return fmt.Errorf("Aggregating %v readings of thermostat %v failed: %w", sampleConfig.ValueType, sampleConfig.ThermostatID, err)
+	}
+
+	// a count is a number of readings rather than a value to correct
+	if sampleConfig.Aggregation != apiv1.AggregationCount {
+		value *= sampleConfig.ValueMultiplier
 	}
+	sample.Value = value
 
-	c.f = f
-	c.in = bufio.NewReader(f)
+	return nil
 }
 
-func (c *client) closeSerialPort() {
-	c.f.Close()
+// getReading returns the latest value for a thermostat id in the form 34:092243 or 01:145038/02, where the optional
+// suffix is the zone index in hex; without zone index the most recent value for any zone of the device is returned
+func (c *client) getReading(thermostatID string, valueType apiv1.ValueType) (value float64, receivedTime time.Time, err error) {
+	address, zoneIndex, err := parseThermostatID(thermostatID)
+	if err != nil {
+		return
+	}
 
-	time.Sleep(5 * time.Second)
+	switch valueType {
+	case apiv1.ValueTypeRSSI, apiv1.ValueTypeMissedBroadcasts, apiv1.ValueTypeActiveFaults:
+		return c.getDeviceValue(address, valueType)
+	}
+
+	_, latest, ok := c.state.Latest(address, zoneIndex, valueType)
+	if !ok {
+		return value, receivedTime, fmt.Errorf("No %v reading available for thermostat %v", valueType, thermostatID)
+	}
+
+	return latest.Value, latest.ReceivedTime, nil
 }
 
-func (c *client) resetSerialPort() {
+// getWindowOpen returns 1 if the zone reports an open window with opcode 12B0 or if its temperature recently dropped
+// at least dropRate °C per hour, and 0 otherwise; the received time is that of the newest reading used
+func (c *client) getWindowOpen(thermostatID string, dropRate float64) (value float64, receivedTime time.Time, err error) {
+	reported, reportedTime, reportedErr := c.getReading(thermostatID, apiv1.ValueTypeWindowOpen)
+	if reportedErr == nil && reported == 1 {
+		return 1, reportedTime, nil
+	}
+	if reportedErr == nil {
+		receivedTime = reportedTime
+	}
 
-	// wait for any previous serial port reset to finish before continuing
-	c.waitGroup.Wait()
+	address, zoneIndex, err := parseThermostatID(thermostatID)
+	if err != nil {
+		return
+	}
 
-	// lock area during reset
-	c.waitGroup.Add(1)
-	defer c.waitGroup.Done()
+	since := c.now().Add(-windowOpenLookback)
+	detected, hasHistory := false, false
+	for _, k := range c.state.Keys() {
+		if k.Address != address || k.ValueType != apiv1.ValueTypeTemperature || (zoneIndex >= 0 && k.ZoneIndex != zoneIndex) {
+			continue
+		}
+		history := c.state.History(k, since)
+		if len(history) == 0 {
+			continue
+		}
+		hasHistory = true
+		if latest := history[len(history)-1].ReceivedTime; latest.After(receivedTime) {
+			receivedTime = latest
+		}
+		if isTemperatureDropping(history, dropRate) {
+			detected = true
+		}
+	}
+
+	if !hasHistory && reportedErr != nil {
+		return value, receivedTime, fmt.Errorf("No window state or recent temperature available for thermostat %v", thermostatID)
+	}
+	if detected {
+		return 1, receivedTime, nil
+	}
 
-	// perform the reset
-	c.closeSerialPort()
-	c.openSerialPort()
+	return 0, receivedTime, nil
 }
 
-func (c *client) keepSerialPortAlive() {
-	for {
-		time.Sleep(time.Duration(foundation.ApplyJitter(120)) * time.Second)
+// isTemperatureDropping returns true if the latest temperature is at least minWindowOpenDrop lower than any earlier
+// one, at a rate of at least dropRate °C per hour
+func isTemperatureDropping(history []state.Reading, dropRate float64) bool {
+	latest := history[len(history)-1]
+	for _, earlier := range history[:len(history)-1] {
+		drop := earlier.Value - latest.Value
+		elapsed := latest.ReceivedTime.Sub(earlier.ReceivedTime)
+		if drop >= minWindowOpenDrop && elapsed > 0 && drop/elapsed.Hours() >= dropRate {
+			return true
+		}
+	}
+
+	return false
+}
 
-		if time.Since(c.lastReceivedMessage).Minutes() > 2 {
-			log.Info().Msg("Received last message more than 2 minutes ago, resetting serial port...")
-			c.resetSerialPort()
+// getDeviceValue returns radio statistics and the fault count of a device, which apply to the device as a whole
+// instead of a zone; their received time is the last time the device got seen
+func (c *client) getDeviceValue(address protocol.Address, valueType apiv1.ValueType) (value float64, receivedTime time.Time, err error) {
+	c.devicesMutex.RLock()
+	defer c.devicesMutex.RUnlock()
+
+	device, ok := c.devices[address]
+	if !ok {
+		return value, receivedTime, fmt.Errorf("No frames received from device %v", address)
+	}
+
+	switch valueType {
+	case apiv1.ValueTypeMissedBroadcasts:
+		return float64(device.MissedBroadcasts), device.LastSeen, nil
+	case apiv1.ValueTypeActiveFaults:
+		if device.Faults == nil {
+			return value, receivedTime, fmt.Errorf("No fault log received from device %v", address)
 		}
+		return float64(countActiveFaults(device.Faults)), device.LastSeen, nil
 	}
+	return device.RSSI.Average, device.LastSeen, nil
 }
 
-func (c *client) receiveResponse() (err error) {
-	// execute commands and read from serial port
-	for {
-		// wait for serial port reset to finish before continuing
-		c.waitGroup.Wait()
+// countActiveFaults counts the faults whose most recent log entry for the same device, zone and fault type isn't a
+// restore
+func countActiveFaults(faults map[int]protocol.FaultLogEntry) (count int) {
+	type faultKey struct {
+		device    protocol.Address
+		zoneIndex int
+		faultType protocol.FaultType
+	}
 
-		// read from serial port
-		buf, isPrefix, err := c.in.ReadLine()
-		if c.teardown {
-			log.Info().Msg("Completing teardown of serial port listener")
-			return nil
+	latest := map[faultKey]protocol.FaultLogEntry{}
+	for _, entry := range faults {
+		key := faultKey{device: entry.Device, zoneIndex: entry.ZoneIndex, faultType: entry.Type}
+		if previous, ok := latest[key]; !ok || entry.LogIndex < previous.LogIndex {
+			latest[key] = entry
 		}
+	}
 
+	for _, entry := range latest {
+		if entry.State == protocol.FaultStateFault {
+			count++
+		}
+	}
+
+	return count
+}
+
+// setBatteryState keeps the battery state of a device for the low battery warnings
+func (c *client) setBatteryState(address protocol.Address, state protocol.BatteryState) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+
+	if device, ok := c.devices[address]; ok {
+		device.Battery = &state
+	}
+}
+
+// warnLowBatteries logs a warning for each device with a low battery, at most once per day per device
+func (c *client) warnLowBatteries(threshold float64) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+
+	now := c.now()
+	for address, device := range c.devices {
+		battery := device.Battery
+		if battery == nil || !(battery.Low || (battery.LevelAvailable && battery.Level <= threshold)) {
+			continue
+		}
+		if lastWarning, ok := c.batteryWarnings[address]; ok && now.Sub(lastWarning) < batteryWarningInterval {
+			continue
+		}
+		c.batteryWarnings[address] = now
+
+		event := log.Warn().
+			Str("device", address.String()).
+			Str("deviceType", address.DeviceTypeName()).
+			Bool("batteryLow", battery.Low)
+		if battery.LevelAvailable {
+			event = event.Float64("batteryLevel", battery.Level)
+		}
+		event.Msgf("Battery of %v %v is low, replace it soon", address.DeviceTypeName(), address)
+	}
+}
+
+// setFaultLogEntry stores a fault log entry of a controller and logs it when it's new or changed
+func (c *client) setFaultLogEntry(address protocol.Address, entry protocol.FaultLogEntry) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+
+	device, ok := c.devices[address]
+	if !ok {
+		return
+	}
+	if device.Faults == nil {
+		device.Faults = map[int]protocol.FaultLogEntry{}
+	}
+
+	if entry.Empty {
+		delete(device.Faults, entry.LogIndex)
+		return
+	}
+
+	previous, ok := device.Faults[entry.LogIndex]
+	device.Faults[entry.LogIndex] = entry
+	if ok && sameFaultLogEntry(previous, entry) {
+		return
+	}
+
+	log.Warn().
+		Str("controller", address.String()).
+		Int("logIndex", entry.LogIndex).
+		Str("state", entry.State.String()).
+		Str("faultType", entry.Type.String()).
+		Int("zoneIndex", entry.ZoneIndex).
+		Str("device", entry.Device.String()).
+		Time("timestamp", *entry.Timestamp).
+		Msgf("Fault log of %v reports %v %v for device %v", address, entry.Type, entry.State, entry.Device)
+}
+
+func sameFaultLogEntry(a, b protocol.FaultLogEntry) bool {
+	return a.State == b.State && a.Type == b.Type && a.ZoneIndex == b.ZoneIndex && a.DeviceClass == b.DeviceClass &&
+		a.Device == b.Device && a.Timestamp.Equal(*b.Timestamp)
+}
+
+// parseThermostatID splits a thermostat id into its address and zone index, which is -1 if not specified
+func parseThermostatID(thermostatID string) (address protocol.Address, zoneIndex int, err error) {
+	parts := strings.SplitN(thermostatID, "/", 2)
+	address = protocol.Address(parts[0])
+	zoneIndex = -1
+
+	if len(parts) == 2 {
+		index, err := strconv.ParseUint(parts[1], 16, 8)
 		if err != nil {
-			if err != io.EOF {
-				log.Warn().Err(err).Msg("Error reading from serial port, resetting port...")
-				c.resetSerialPort()
-			}
-		} else if isPrefix {
-			log.Warn().Str("_msg", string(buf)).Msgf("Message is too long for buffer and split over multiple lines")
-		} else {
+			return address, zoneIndex, fmt.Errorf("Zone index in thermostat id %v is not a hex number: %w", thermostatID, err)
+		}
+		zoneIndex = int(index)
+	}
 
-			c.lastReceivedMessage = time.Now().UTC()
-			// c.responseChannel <- buf
+	return address, zoneIndex, nil
+}
 
-			rawmsg := string(buf)
-			length := len(rawmsg)
+func (c *client) setReading(address protocol.Address, zoneIndex int, valueType apiv1.ValueType, value float64, receivedTime time.Time) {
+	c.state.Set(state.Key{Address: address, ZoneIndex: zoneIndex, ValueType: valueType}, value, receivedTime)
+}
+
+// setOrRemoveReading stores the value if available or otherwise removes the previous value so it doesn't get reported
+func (c *client) setOrRemoveReading(address protocol.Address, zoneIndex int, valueType apiv1.ValueType, value float64, available bool, receivedTime time.Time) {
+	if !available {
+		c.removeReading(address, zoneIndex, valueType)
+		return
+	}
+	c.setReading(address, zoneIndex, valueType, value, receivedTime)
+}
+
+func (c *client) removeReading(address protocol.Address, zoneIndex int, valueType apiv1.ValueType) {
+	c.state.Remove(state.Key{Address: address, ZoneIndex: zoneIndex, ValueType: valueType})
+}
+
+// readLines handles lines from the connection until reading fails, the antenna is silent for too long or the context
+// gets cancelled; it always closes the connection before returning
+func (c *client) readLines(ctx context.Context, connection io.ReadWriteCloser) (err error) {
+
+	c.connectionMutex.Lock()
+	c.connection = connection
+	c.lastReceivedMessage = time.Now().UTC()
+	c.connectionMutex.Unlock()
 
-			// make sure no obvious errors in getting the data....
-			if length > 40 &&
-				!strings.Contains(rawmsg, "_ENC") &&
-				!strings.Contains(rawmsg, "_BAD") &&
-				!strings.Contains(rawmsg, "BAD") &&
-				!strings.Contains(rawmsg, "ERR") {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	readerDone := make(chan struct{})
+	// done stops the reader once readLines returns, also when the context is still live
+	done := make(chan struct{})
 
-				isValidMessage, err := regexp.MatchString(`^\d{3} ( I| W|RQ|RP) --- (--:------|\d{2}:\d{6}) (--:------ |\d{2}:\d{6} ){2}[0-9a-fA-F]{4} \d{3}`, rawmsg)
-				if err != nil || !isValidMessage {
-					log.Info().Msgf("read: %v", rawmsg)
-				} else {
-					log.Debug().Msgf("evohome: %v / %v", rawmsg, buf)
+	go func() {
+		defer close(readerDone)
+
+		in := bufio.NewReader(connection)
+		for {
+			buf, isPrefix, err := in.ReadLine()
+			if err == io.EOF {
+				// the serial port returns EOF when no data arrived within its read timeout
+				select {
+				case <-done:
+					return
+				default:
+					continue
 				}
-			} else {
-				log.Info().Msgf("read: %v / %v", rawmsg, buf)
 			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if isPrefix {
+				log.Warn().Str("_msg", string(buf)).Msgf("Message is too long for buffer and split over multiple lines")
+				c.record(time.Now().UTC(), string(buf), nil, fmt.Errorf("Message is too long for buffer"))
+				continue
+			}
+
+			select {
+			case lines <- string(buf):
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// closing the connection unblocks the reader
+	defer func() {
+		c.connectionMutex.Lock()
+		c.connection = nil
+		c.connectionMutex.Unlock()
+
+		close(done)
+		connection.Close()
+		<-readerDone
+	}()
+
+	watchdog := time.NewTicker(c.silenceTimeout / 4)
+	defer watchdog.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case err := <-readErr:
+			return fmt.Errorf("Failed reading from antenna: %w", err)
+
+		case line := <-lines:
+			c.handleLine(time.Now().UTC(), line)
+
+		case <-watchdog.C:
+			if silence := time.Since(c.getLastReceivedMessage()); silence > c.silenceTimeout {
+				return fmt.Errorf("Received last message %v ago, resetting connection", silence.Round(time.Second))
+			}
+		}
+	}
+}
+
+// getLastReceivedMessage returns the time the last line got received from the antenna
+func (c *client) getLastReceivedMessage() time.Time {
+	c.connectionMutex.RLock()
+	defer c.connectionMutex.RUnlock()
+
+	return c.lastReceivedMessage
+}
+
+// handleLine parses and decodes a single line received by the antenna
+func (c *client) handleLine(receivedTime time.Time, rawmsg string) {
+
+	frame, err := protocol.ParseFrame(rawmsg)
+	if err != nil {
+		if uponorFrame, uponorErr := protocol.ParseUponorFrame(rawmsg); uponorErr == nil {
+			c.handleUponorLine(receivedTime, rawmsg, uponorFrame)
+			return
+		}
+	}
+	foreign := err == nil && c.filter != nil && !c.filter.Allow(frame)
+
+	c.connectionMutex.Lock()
+	c.lastReceivedMessage = receivedTime
+	switch {
+	case err != nil:
+		c.parseFailures++
+	case foreign:
+		c.foreignFrames++
+	default:
+		c.lastValidFrame = receivedTime
+		c.framesReceived[frame.Opcode]++
+	}
+	c.connectionMutex.Unlock()
+
+	c.record(receivedTime, rawmsg, frame, err)
+	if err != nil {
+		log.Info().Err(err).Msgf("read: %v", rawmsg)
+		return
+	}
+
+	// replies to own commands are always accepted, even from devices the filter doesn't know yet
+	c.matchReply(frame)
+	if foreign {
+		return
+	}
+
+	c.updateDevice(frame.Source(), frame.RSSI, frame.Opcode, frame.Verb == protocol.VerbInformation, receivedTime)
+	c.handleFrame(frame, receivedTime)
+}
+
+// updateDevice keeps track of the devices sending frames and the quality of their radio link; only broadcasts are
+// periodic, requests and replies come whenever another device asks
+func (c *client) updateDevice(address protocol.Address, rssi int, opcode protocol.Opcode, broadcast bool, receivedTime time.Time) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+
+	device, ok := c.devices[address]
+	if !ok {
+		device = &Device{
+			Address:   address,
+			FirstSeen: receivedTime,
+			Opcodes:   map[protocol.Opcode]uint64{},
+			RSSI: RSSIStatistics{
+				Min:     rssi,
+				Max:     rssi,
+				Average: float64(rssi),
+			},
+		}
+		c.devices[address] = device
+	}
+
+	device.LastSeen = receivedTime
+	device.Frames++
+	device.Opcodes[opcode]++
+
+	device.RSSI.Last = rssi
+	if rssi < device.RSSI.Min {
+		device.RSSI.Min = rssi
+	}
+	if rssi > device.RSSI.Max {
+		device.RSSI.Max = rssi
+	}
+	device.RSSI.Average = rssiSmoothing*float64(rssi) + (1-rssiSmoothing)*device.RSSI.Average
+
+	if !broadcast {
+		return
+	}
+
+	key := broadcastKey{address: address, opcode: opcode}
+	timing, ok := c.broadcastTimings[key]
+	if !ok {
+		c.broadcastTimings[key] = &broadcastTiming{lastTime: receivedTime}
+		return
+	}
+
+	interval := receivedTime.Sub(timing.lastTime)
+	timing.lastTime = receivedTime
+	if interval <= 0 {
+		return
+	}
+
+	if timing.intervals >= minIntervalsForMissing && float64(interval) > missedIntervalFactor*float64(timing.averageInterval) {
+		device.MissedBroadcasts += uint64((interval+timing.averageInterval/2)/timing.averageInterval) - 1
+	}
+	if interval > device.MaxBroadcastInterval {
+		device.MaxBroadcastInterval = interval
+	}
+
+	if timing.intervals == 0 {
+		timing.averageInterval = interval
+	} else {
+		timing.averageInterval = time.Duration(intervalSmoothing*float64(interval) + (1-intervalSmoothing)*float64(timing.averageInterval))
+	}
+	timing.intervals++
+}
+
+func (c *client) record(receivedTime time.Time, raw string, frame *protocol.Frame, parseErr error) {
+	if c.recorder == nil {
+		return
+	}
+
+	err := c.recorder.Record(receivedTime, raw, frame, parseErr)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed recording received line to capture file")
+	}
+}
+
+func (c *client) handleFrame(frame *protocol.Frame, receivedTime time.Time) {
+	log.Debug().
+		Int("rssi", frame.RSSI).
+		Str("verb", string(frame.Verb)).
+		Str("source", frame.Source().String()).
+		Str("destination", frame.Destination().String()).
+		Str("opcode", string(frame.Opcode)).
+		Int("length", frame.Length).
+		Msgf("evohome: %v", frame.Raw)
+
+	// requests carry no values
+	if frame.Verb == protocol.VerbRequest {
+		return
+	}
+
+	switch frame.Opcode {
+	case protocol.OpcodeZoneTemperature:
+		temperatures, err := protocol.DecodeZoneTemperatures(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding zone temperatures from %v", frame.Raw)
+			return
+		}
+		for _, t := range temperatures {
+			c.setOrRemoveReading(frame.Source(), t.ZoneIndex, apiv1.ValueTypeTemperature, t.Temperature, t.Available, receivedTime)
+		}
+
+	case protocol.OpcodeZoneSetpoint:
+		setpoints, err := protocol.DecodeZoneSetpoints(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding zone setpoints from %v", frame.Raw)
+			return
+		}
+		for _, s := range setpoints {
+			c.setOrRemoveReading(frame.Source(), s.ZoneIndex, apiv1.ValueTypeSetpoint, s.Setpoint, s.Available, receivedTime)
+		}
+
+	case protocol.OpcodeZoneMode:
+		override, err := protocol.DecodeZoneSetpointOverride(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding zone setpoint override from %v", frame.Raw)
+			return
+		}
+		log.Debug().Interface("override", override).Msgf("Zone %v of %v has mode %v", override.ZoneIndex, frame.Source(), override.Mode)
+		c.setOrRemoveReading(frame.Source(), override.ZoneIndex, apiv1.ValueTypeOverrideSetpoint, override.Setpoint, override.Available, receivedTime)
+		c.setReading(frame.Source(), override.ZoneIndex, apiv1.ValueTypeOverrideMode, float64(override.Mode), receivedTime)
+
+	case protocol.OpcodeHeatDemand:
+		demands, err := protocol.DecodeHeatDemands(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding heat demands from %v", frame.Raw)
+			return
+		}
+		for _, d := range demands {
+			c.setOrRemoveReading(frame.Source(), d.ZoneIndex, apiv1.ValueTypeHeatDemand, d.Demand, d.Available, receivedTime)
+		}
+
+	case protocol.OpcodeRelayDemand:
+		demand, err := protocol.DecodeRelayDemand(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding relay demand from %v", frame.Raw)
+			return
+		}
+		c.setOrRemoveReading(frame.Source(), demand.ZoneIndex, apiv1.ValueTypeRelayDemand, demand.Demand, demand.Available, receivedTime)
+
+	case protocol.OpcodeActuatorState:
+		state, err := protocol.DecodeActuatorState(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding actuator state from %v", frame.Raw)
+			return
+		}
+		c.setOrRemoveReading(frame.Source(), state.ZoneIndex, apiv1.ValueTypeActuatorState, state.ModulationLevel, state.Available, receivedTime)
+
+	case protocol.OpcodeBatteryState:
+		state, err := protocol.DecodeBatteryState(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding battery state from %v", frame.Raw)
+			return
+		}
+		low := 0.0
+		if state.Low {
+			low = 1
+		}
+		c.setOrRemoveReading(frame.Source(), state.ZoneIndex, apiv1.ValueTypeBatteryLevel, state.Level, state.LevelAvailable, receivedTime)
+		c.setReading(frame.Source(), state.ZoneIndex, apiv1.ValueTypeBatteryLow, low, receivedTime)
+		c.setBatteryState(frame.Source(), state)
+
+	case protocol.OpcodeFaultLog:
+		entry, err := protocol.DecodeFaultLogEntry(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding fault log entry from %v", frame.Raw)
+			return
+		}
+		c.setFaultLogEntry(frame.Source(), entry)
+
+	case protocol.OpcodeWindowState:
+		state, err := protocol.DecodeWindowState(frame)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed decoding window state from %v", frame.Raw)
+			return
+		}
+		open := 0.0
+		if state.Open {
+			open = 1
 		}
+		c.setOrRemoveReading(frame.Source(), state.ZoneIndex, apiv1.ValueTypeWindowOpen, open, state.Available, receivedTime)
 	}
 }
@@ -1,24 +1,26 @@
 package antenna
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
 	"testing"
+	"time"
 
 	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
 	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetMeasurement(t *testing.T) {
 	t.Run("ReturnsMeasurement", func(t *testing.T) {
 
-		if testing.Short() {
-			t.Skip("skipping test in short mode.")
-		}
-
-		waitGroup := &sync.WaitGroup{}
-		done := make(chan struct{})
-		client, err := NewClient("/dev/ttyUSB0", waitGroup, done)
+		transport, err := NewTransport("/dev/ttyUSB0")
+		assert.Nil(t, err)
+		client, err := NewClient(transport, nil, nil)
 		assert.Nil(t, err)
 
 		config := apiv1.Config{
@@ -26,22 +28,18 @@ func TestGetMeasurement(t *testing.T) {
 		}
 
 		// act
-		measurement, err := client.GetMeasurement(config)
+		measurement, _, err := client.GetMeasurement(config)
 
 		assert.Nil(t, err)
 		assert.Equal(t, "My address", measurement.Location)
+		assert.Equal(t, "jarvis-uponor-smatrix-exporter", measurement.Source)
+		assert.NotEmpty(t, measurement.ID)
 	})
 
 	t.Run("ReturnsMeasurementWithSample", func(t *testing.T) {
 
-		if testing.Short() {
-			t.Skip("skipping test in short mode.")
-		}
-
-		waitGroup := &sync.WaitGroup{}
-		done := make(chan struct{})
-		client, err := NewClient("/dev/ttyUSB0", waitGroup, done)
-		assert.Nil(t, err)
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0"), time.Now().UTC())
 
 		config := apiv1.Config{
 			Location: "My address",
@@ -53,18 +51,1213 @@ func TestGetMeasurement(t *testing.T) {
 					SampleName:      "Living room",
 					MetricType:      "METRIC_TYPE_GAUGE",
 					ValueMultiplier: 1,
-					ThermostatID:    "abcd",
+					ThermostatID:    "34:092243",
+					ValueType:       apiv1.ValueTypeTemperature,
 				},
 			},
 		}
 
 		// act
-		measurement, err := client.GetMeasurement(config)
+		measurement, _, err := c.GetMeasurement(config)
 
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(measurement.Samples))
 		assert.Equal(t, "Uponor Smatrix", measurement.Samples[0].EntityName)
 		assert.Equal(t, "Living room", measurement.Samples[0].SampleName)
 		assert.Equal(t, contractsv1.MetricType_METRIC_TYPE_GAUGE, measurement.Samples[0].MetricType)
+		assert.Equal(t, 20.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("SkipsSampleWithoutReading", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		config := apiv1.Config{
+			Location: "My address",
+			SampleConfigs: []apiv1.ConfigSample{
+				{
+					SampleName:      "Living room",
+					ValueMultiplier: 1,
+					ThermostatID:    "34:092243",
+					ValueType:       apiv1.ValueTypeTemperature,
+				},
+			},
+		}
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(measurement.Samples))
+	})
+}
+
+func TestListen(t *testing.T) {
+	t.Run("HandlesLinesUntilCancelled", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		listenErr := make(chan error)
+
+		// act
+		go func() {
+			listenErr <- c.Listen(ctx)
+		}()
+		connection := <-transport.connections
+		connection.writeLine("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		assert.Eventually(t, func() bool {
+			value, _, err := c.getReading("34:092243", apiv1.ValueTypeTemperature)
+			return err == nil && value == 20.0
+		}, time.Second, time.Millisecond)
+		cancel()
+		select {
+		case err := <-listenErr:
+			assert.Nil(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Listen did not return after cancellation")
+		}
+		statuses := readStatuses(c)
+		assert.Equal(t, 1, len(statuses))
+		assert.True(t, statuses[0].Connected)
+		assert.True(t, connection.isClosed())
+		assert.Equal(t, uint64(1), c.GetStatistics().FramesReceived["30C9"])
+	})
+
+	t.Run("ReconnectsWithBackoffWhenOpenFails", func(t *testing.T) {
+
+		transport := newFakeTransport(2)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		listenErr := make(chan error)
+
+		// act
+		go func() {
+			listenErr <- c.Listen(ctx)
+		}()
+		<-transport.connections
+		cancel()
+
+		assert.Nil(t, <-listenErr)
+		statuses := readStatuses(c)
+		if assert.Equal(t, 3, len(statuses)) {
+			assert.False(t, statuses[0].Connected)
+			assert.NotNil(t, statuses[0].Err)
+			assert.False(t, statuses[1].Connected)
+			assert.True(t, statuses[2].Connected)
+		}
+	})
+
+	t.Run("ReconnectsWhenReadingFails", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		listenErr := make(chan error)
+
+		// act
+		go func() {
+			listenErr <- c.Listen(ctx)
+		}()
+		connection := <-transport.connections
+		connection.writer.CloseWithError(fmt.Errorf("Device unplugged"))
+		<-transport.connections
+		cancel()
+
+		assert.Nil(t, <-listenErr)
+		statuses := readStatuses(c)
+		if assert.Equal(t, 3, len(statuses)) {
+			assert.False(t, statuses[1].Connected)
+			assert.Contains(t, statuses[1].Err.Error(), "Device unplugged")
+		}
+		assert.Equal(t, uint64(1), c.GetStatistics().ConnectionResets)
+		assert.False(t, c.GetStatistics().Connected)
+	})
+
+	t.Run("ReconnectsWhenAntennaIsSilent", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		c.silenceTimeout = 20 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		listenErr := make(chan error)
+
+		// act
+		go func() {
+			listenErr <- c.Listen(ctx)
+		}()
+		first := <-transport.connections
+		<-transport.connections
+		cancel()
+
+		assert.Nil(t, <-listenErr)
+		assert.True(t, first.isClosed())
+	})
+}
+
+func TestGetSample(t *testing.T) {
+	t.Run("ReturnsTemperatureForThermostat", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0"), time.Now().UTC())
+
+		sampleConfig := apiv1.ConfigSample{
+			EntityType:      "ENTITY_TYPE_ZONE",
+			EntityName:      "Uponor Smatrix",
+			SampleType:      "SAMPLE_TYPE_TEMPERATURE",
+			SampleName:      "Living room",
+			MetricType:      "METRIC_TYPE_GAUGE",
+			ValueMultiplier: 1,
+			ThermostatID:    "34:092243",
+			ValueType:       apiv1.ValueTypeTemperature,
+		}
+
+		// act
+		sample, err := c.GetSample(apiv1.Config{}, sampleConfig)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Living room", sample.SampleName)
+		assert.Equal(t, 20.0, sample.Value)
+	})
+
+	t.Run("ReturnsTemperatureForZoneOfMultiZoneBroadcast", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 30C9 009 0007D00108CA02FF9C"), time.Now().UTC())
+
+		sampleConfig := apiv1.ConfigSample{
+			ValueMultiplier: 2,
+			ThermostatID:    "01:145038/01",
+			ValueType:       apiv1.ValueTypeTemperature,
+		}
+
+		// act
+		sample, err := c.GetSample(apiv1.Config{}, sampleConfig)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 45.0, sample.Value)
+	})
+
+	t.Run("ReturnsErrorWhenTemperatureBecameUnavailable", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0"), time.Now().UTC())
+		c.handleFrame(mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 007FFF"), time.Now().UTC())
+
+		sampleConfig := apiv1.ConfigSample{
+			ValueMultiplier: 1,
+			ThermostatID:    "34:092243",
+			ValueType:       apiv1.ValueTypeTemperature,
+		}
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, sampleConfig)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsSetpointAndTemperatureForSameThermostat", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 30C9 003 0107D0"), time.Now().UTC())
+		c.handleFrame(mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 2309 006 00076C010834"), time.Now().UTC())
+
+		temperatureConfig := apiv1.ConfigSample{
+			SampleType:      "SAMPLE_TYPE_TEMPERATURE",
+			ValueMultiplier: 1,
+			ThermostatID:    "01:145038/01",
+			ValueType:       apiv1.ValueTypeTemperature,
+		}
+		setpointConfig := apiv1.ConfigSample{
+			SampleType:      "SAMPLE_TYPE_TEMPERATURE_SETPOINT",
+			ValueMultiplier: 1,
+			ThermostatID:    "01:145038/01",
+			ValueType:       apiv1.ValueTypeSetpoint,
+		}
+
+		// act
+		temperature, temperatureErr := c.GetSample(apiv1.Config{}, temperatureConfig)
+		setpoint, setpointErr := c.GetSample(apiv1.Config{}, setpointConfig)
+
+		assert.Nil(t, temperatureErr)
+		assert.Nil(t, setpointErr)
+		assert.Equal(t, 20.0, temperature.Value)
+		assert.Equal(t, 21.0, setpoint.Value)
+		assert.Equal(t, contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE_SETPOINT, setpoint.SampleType)
+	})
+
+	t.Run("ReturnsOverrideSetpointAndMode", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 2349 013 02076C04FFFFFF1E160B0A07E4"), time.Now().UTC())
+
+		// act
+		overrideSetpoint, overrideSetpointErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "01:145038/02", ValueType: apiv1.ValueTypeOverrideSetpoint})
+		overrideMode, overrideModeErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "01:145038/02", ValueType: apiv1.ValueTypeOverrideMode})
+
+		assert.Nil(t, overrideSetpointErr)
+		assert.Nil(t, overrideModeErr)
+		assert.Equal(t, 19.0, overrideSetpoint.Value)
+		assert.Equal(t, 4.0, overrideMode.Value)
+	})
+
+	t.Run("ReturnsHeatDemandRelayDemandAndActuatorState", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleFrame(mustParseFrame(t, "045  I --- 02:001107 --:------ 02:001107 3150 004 00C80132"), time.Now().UTC())
+		c.handleFrame(mustParseFrame(t, "045  I --- 02:001107 --:------ 02:001107 0008 002 0164"), time.Now().UTC())
+		c.handleFrame(mustParseFrame(t, "045  I --- 13:163733 --:------ 13:163733 3EF0 003 00C8FF"), time.Now().UTC())
+
+		// act
+		heatDemand, heatDemandErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "02:001107/01", ValueType: apiv1.ValueTypeHeatDemand})
+		relayDemand, relayDemandErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "02:001107/01", ValueType: apiv1.ValueTypeRelayDemand})
+		actuatorState, actuatorStateErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 0.01, ThermostatID: "13:163733", ValueType: apiv1.ValueTypeActuatorState})
+
+		assert.Nil(t, heatDemandErr)
+		assert.Nil(t, relayDemandErr)
+		assert.Nil(t, actuatorStateErr)
+		assert.Equal(t, 25.0, heatDemand.Value)
+		assert.Equal(t, 50.0, relayDemand.Value)
+		assert.Equal(t, 1.0, actuatorState.Value)
+	})
+
+	t.Run("ReturnsErrorForUnknownThermostat", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		sampleConfig := apiv1.ConfigSample{
+			ValueMultiplier: 1,
+			ThermostatID:    "abcd",
+			ValueType:       apiv1.ValueTypeTemperature,
+		}
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, sampleConfig)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func newTestClient(t *testing.T) *client {
+	c, err := NewClient(&serialTransport{devicePath: "/dev/ttyUSB0"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*client)
+}
+
+func mustParseFrame(t *testing.T, line string) *protocol.Frame {
+	frame, err := protocol.ParseFrame(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return frame
+}
+
+func TestGetStatistics(t *testing.T) {
+	t.Run("CountsFramesPerOpcodeAndParseFailures", func(t *testing.T) {
+
+		c := newTestClient(t)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 2309 003 0007D0")
+		c.handleLine(receivedTime, "# evofw3 0.7.0")
+
+		// act
+		statistics := c.GetStatistics()
+
+		assert.Equal(t, map[protocol.Opcode]uint64{"30C9": 2, "2309": 1}, statistics.FramesReceived)
+		assert.Equal(t, uint64(1), statistics.ParseFailures)
+		assert.Equal(t, receivedTime, statistics.LastReceivedMessage)
+		assert.Equal(t, receivedTime, statistics.LastValidFrame)
+	})
+}
+
+func TestGetDevices(t *testing.T) {
+	t.Run("ReturnsDevicesWithOpcodesAndAvailableValuesOrderedByAddress", func(t *testing.T) {
+
+		c := newTestClient(t)
+		firstTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		lastTime := firstTime.Add(time.Minute)
+		c.handleLine(firstTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(firstTime, "060  I --- 01:145038 --:------ 01:145038 30C9 006 0007D0010834")
+		c.handleLine(lastTime, "062  I --- 01:145038 --:------ 01:145038 2309 003 0107D0")
+
+		// act
+		devices := c.GetDevices()
+
+		if assert.Equal(t, 2, len(devices)) {
+			assert.Equal(t, protocol.Address("01:145038"), devices[0].Address)
+			assert.Equal(t, firstTime, devices[0].FirstSeen)
+			assert.Equal(t, lastTime, devices[0].LastSeen)
+			assert.Equal(t, 62, devices[0].RSSI.Last)
+			assert.Equal(t, map[protocol.Opcode]uint64{"30C9": 1, "2309": 1}, devices[0].Opcodes)
+			assert.Equal(t, map[int][]apiv1.ValueType{0: {apiv1.ValueTypeTemperature}, 1: {apiv1.ValueTypeSetpoint, apiv1.ValueTypeTemperature}}, devices[0].ValueTypes)
+
+			assert.Equal(t, protocol.Address("34:092243"), devices[1].Address)
+			assert.Equal(t, map[int][]apiv1.ValueType{0: {apiv1.ValueTypeTemperature}}, devices[1].ValueTypes)
+		}
+	})
+}
+
+func TestLinkQuality(t *testing.T) {
+	t.Run("TracksRSSIPerDevice", func(t *testing.T) {
+
+		c := newTestClient(t)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+
+		// act
+		c.handleLine(receivedTime, "050  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(receivedTime, "040  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(receivedTime, "060  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		devices := c.GetDevices()
+		if assert.Equal(t, 1, len(devices)) {
+			assert.Equal(t, uint64(3), devices[0].Frames)
+			assert.Equal(t, 60, devices[0].RSSI.Last)
+			assert.Equal(t, 40, devices[0].RSSI.Min)
+			assert.Equal(t, 60, devices[0].RSSI.Max)
+			assert.InDelta(t, 50.1, devices[0].RSSI.Average, 0.001)
+		}
+		rssi, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeRSSI})
+		assert.Nil(t, err)
+		assert.InDelta(t, 50.1, rssi.Value, 0.001)
+	})
+
+	t.Run("EstimatesMissedBroadcastsFromGapsPerOpcode", func(t *testing.T) {
+
+		c := newTestClient(t)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+
+		// act
+		for i := 0; i < 5; i++ {
+			c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+			// other opcodes and requests in between don't count as broadcasts of 30C9
+			c.handleLine(receivedTime.Add(time.Second), "045  I --- 34:092243 --:------ 34:092243 2309 003 0007D0")
+			c.handleLine(receivedTime.Add(2*time.Second), "045 RQ --- 34:092243 01:145038 --:------ 0004 002 0000")
+			receivedTime = receivedTime.Add(10 * time.Minute)
+		}
+		// three broadcasts of 30C9 didn't arrive
+		receivedTime = receivedTime.Add(30 * time.Minute)
+		c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		devices := c.GetDevices()
+		if assert.Equal(t, 1, len(devices)) {
+			assert.Equal(t, uint64(3), devices[0].MissedBroadcasts)
+			assert.Equal(t, 40*time.Minute, devices[0].MaxBroadcastInterval)
+		}
+		missed, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeMissedBroadcasts})
+		assert.Nil(t, err)
+		assert.Equal(t, float64(3), missed.Value)
+	})
+
+	t.Run("ReturnsErrorForUnknownDevice", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeRSSI})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestUponorFrames(t *testing.T) {
+	t.Run("ReturnsSamplesForUponorThermostat", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleLine(time.Now().UTC(), "045 110BDE134002B13B02BA41030242002D3D00406438")
+
+		// act
+		temperature, temperatureErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "uponor:110B:DE13", ValueType: apiv1.ValueTypeTemperature})
+		setpoint, setpointErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "uponor:110B:DE13", ValueType: apiv1.ValueTypeSetpoint})
+		floor, floorErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "uponor:110B:DE13", ValueType: apiv1.ValueTypeFloorTemperature})
+		humidity, humidityErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "uponor:110B:DE13", ValueType: apiv1.ValueTypeHumidity})
+		demand, demandErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "uponor:110B:DE13", ValueType: apiv1.ValueTypeHeatDemand})
+
+		assert.Nil(t, temperatureErr)
+		assert.Nil(t, setpointErr)
+		assert.Nil(t, floorErr)
+		assert.Nil(t, humidityErr)
+		assert.Nil(t, demandErr)
+		assert.Equal(t, 20.5, temperature.Value)
+		assert.Equal(t, 21.0, setpoint.Value)
+		assert.Equal(t, 25.0, floor.Value)
+		assert.Equal(t, 45.0, humidity.Value)
+		assert.Equal(t, 100.0, demand.Value)
+	})
+
+	t.Run("CountsUponorFramesAsValidFrames", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		// act
+		c.handleLine(time.Now().UTC(), "045 110BDE13407FFFD649")
+
+		statistics := c.GetStatistics()
+		assert.Equal(t, uint64(0), statistics.ParseFailures)
+		assert.Equal(t, map[protocol.Opcode]uint64{protocol.OpcodeUponor: 1}, statistics.FramesReceived)
+		devices := c.GetDevices()
+		if assert.Equal(t, 1, len(devices)) {
+			assert.Equal(t, protocol.Address("uponor:110B:DE13"), devices[0].Address)
+			assert.Equal(t, 45, devices[0].RSSI.Last)
+		}
+	})
+}
+
+func TestBatteryAndFaults(t *testing.T) {
+	t.Run("ReturnsBatteryLevelAndLowFlag", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleLine(time.Now().UTC(), "045  I --- 34:092243 --:------ 34:092243 1060 003 002800")
+
+		// act
+		level, levelErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeBatteryLevel})
+		low, lowErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeBatteryLow})
+
+		assert.Nil(t, levelErr)
+		assert.Nil(t, lowErr)
+		assert.Equal(t, 20.0, level.Value)
+		assert.Equal(t, 1.0, low.Value)
+		devices := c.GetDevices()
+		if assert.Equal(t, 1, len(devices)) && assert.NotNil(t, devices[0].Battery) {
+			assert.True(t, devices[0].Battery.Low)
+		}
+	})
+
+	t.Run("WarnsAboutLowBatteryOncePerDay", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now, "045  I --- 34:092243 --:------ 34:092243 1060 003 002801")
+		c.handleLine(now, "045  I --- 34:111111 --:------ 34:111111 1060 003 00C801")
+		config := apiv1.Config{BatteryLowThreshold: 20}
+
+		// act
+		_, _, err := c.GetMeasurement(config)
+		now = now.Add(time.Hour)
+		_, _, _ = c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[protocol.Address]time.Time{"34:092243": now.Add(-time.Hour)}, c.batteryWarnings)
+
+		now = now.Add(24 * time.Hour)
+		_, _, _ = c.GetMeasurement(config)
+		assert.Equal(t, map[protocol.Address]time.Time{"34:092243": now}, c.batteryWarnings)
+	})
+
+	t.Run("CountsActiveFaultsFromFaultLog", func(t *testing.T) {
+
+		c := newTestClient(t)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		// the most recent entry restores the battery fault of log index 1, the one of log index 2 is still active
+		c.handleLine(receivedTime, "045 RP --- 01:145038 18:013393 --:------ 0418 022 004000B0040204000000A594B3C780FFFF700010DAF9")
+		c.handleLine(receivedTime, "045 RP --- 01:145038 18:013393 --:------ 0418 022 000001B0040204000000A594B3C780FFFF700010DAF9")
+		c.handleLine(receivedTime, "045 RP --- 01:145038 18:013393 --:------ 0418 022 000002B0060304000000A594B3C780FFFF7000109C40")
+		c.handleLine(receivedTime, "045 RP --- 01:145038 18:013393 --:------ 0418 022 000003B0000000000000000000007FFFFF7000000000")
+
+		// act
+		activeFaults, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "01:145038", ValueType: apiv1.ValueTypeActiveFaults})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1.0, activeFaults.Value)
+		devices := c.GetDevices()
+		if assert.Equal(t, 1, len(devices)) {
+			assert.Equal(t, 3, len(devices[0].Faults))
+			assert.Equal(t, protocol.Address("04:040000"), devices[0].Faults[2].Device)
+		}
+	})
+
+	t.Run("ReturnsErrorWithoutFaultLog", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleLine(time.Now().UTC(), "045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0")
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "01:145038", ValueType: apiv1.ValueTypeActiveFaults})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestWindowOpen(t *testing.T) {
+	t.Run("ReturnsReportedWindowState", func(t *testing.T) {
+
+		c := newTestClient(t)
+		c.handleLine(time.Now().UTC(), "045  I --- 04:056057 --:------ 04:056057 12B0 003 00C800")
+
+		// act
+		windowOpen, err := c.GetSample(apiv1.Config{WindowOpenDropRate: 4}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "04:056057", ValueType: apiv1.ValueTypeWindowOpen})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1.0, windowOpen.Value)
+	})
+
+	t.Run("DetectsOpenWindowFromFastTemperatureDrop", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-10*time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(now.Add(-5*time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007A8")
+		c.handleLine(now, "045  I --- 34:092243 --:------ 34:092243 30C9 003 000780")
+		sampleConfig := apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeWindowOpen}
+
+		// act
+		windowOpen, err := c.GetSample(apiv1.Config{WindowOpenDropRate: 4}, sampleConfig)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1.0, windowOpen.Value)
+
+		// a slower drop of 0.8°C in 10 minutes doesn't count
+		windowOpen, err = c.GetSample(apiv1.Config{WindowOpenDropRate: 6}, sampleConfig)
+		assert.Nil(t, err)
+		assert.Equal(t, 0.0, windowOpen.Value)
+
+		// the drop is forgotten once it's older than the lookback
+		now = now.Add(windowOpenLookback)
+		c.handleLine(now, "045  I --- 34:092243 --:------ 34:092243 30C9 003 000780")
+		windowOpen, err = c.GetSample(apiv1.Config{WindowOpenDropRate: 4}, sampleConfig)
+		assert.Nil(t, err)
+		assert.Equal(t, 0.0, windowOpen.Value)
+	})
+
+	t.Run("IgnoresSmallDrops", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(now, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007BC")
+
+		// act
+		windowOpen, err := c.GetSample(apiv1.Config{WindowOpenDropRate: 4}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeWindowOpen})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0.0, windowOpen.Value)
+	})
+
+	t.Run("ReturnsErrorWithoutWindowStateOrTemperature", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		// act
+		_, err := c.GetSample(apiv1.Config{WindowOpenDropRate: 4}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeWindowOpen})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestStaleSamples(t *testing.T) {
+	t.Run("OmitsSamplesOlderThanMaxAge", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-2*time.Hour), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(now.Add(-time.Minute), "045  I --- 34:111111 --:------ 34:111111 30C9 003 000780")
+		config := apiv1.Config{
+			MaxAge: time.Hour,
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Living room", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature},
+				{SampleName: "Bathroom", ValueMultiplier: 1, ThermostatID: "34:111111", ValueType: apiv1.ValueTypeTemperature},
+			},
+		}
+
+		// act
+		measurement, sampleConfigs, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, "Bathroom", measurement.Samples[0].SampleName)
+		}
+		assert.Equal(t, config.SampleConfigs[1:], sampleConfigs)
+		statistics := c.GetStatistics()
+		assert.Equal(t, uint64(1), statistics.StaleSamples)
+		assert.Equal(t, []string{"34:092243"}, statistics.QuietThermostats)
+
+		// the thermostat is no longer quiet once it sends again
+		c.handleLine(now, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		measurement, _, err = c.GetMeasurement(config)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(measurement.Samples))
+		statistics = c.GetStatistics()
+		assert.Equal(t, uint64(1), statistics.StaleSamples)
+		assert.Equal(t, []string{}, statistics.QuietThermostats)
+	})
+
+	t.Run("KeepsThermostatWithFreshAndStaleSampleSending", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-2*time.Hour), "045  I --- 34:092243 --:------ 34:092243 2309 003 0007D0")
+		c.handleLine(now.Add(-time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 000780")
+		config := apiv1.Config{
+			MaxAge: time.Hour,
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Living room setpoint", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeSetpoint},
+				{SampleName: "Living room", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature},
+			},
+		}
+
+		// act
+		measurement, sampleConfigs, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, config.SampleConfigs[1:], sampleConfigs)
+		statistics := c.GetStatistics()
+		assert.Equal(t, uint64(1), statistics.StaleSamples)
+		assert.Equal(t, []string{}, statistics.QuietThermostats)
+
+		// the thermostat only goes quiet once its temperature is stale as well
+		now = now.Add(time.Hour)
+		_, _, err = c.GetMeasurement(config)
+		assert.Nil(t, err)
+		statistics = c.GetStatistics()
+		assert.Equal(t, uint64(3), statistics.StaleSamples)
+		assert.Equal(t, []string{"34:092243"}, statistics.QuietThermostats)
+	})
+
+	t.Run("KeepsRarelyBroadcastSamplesWithDefaultConfig", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-3*time.Hour), "045  I --- 34:092243 --:------ 34:092243 1060 003 002800")
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Living room battery", ThermostatID: "34:092243", ValueType: apiv1.ValueTypeBatteryLevel},
+			},
+		}
+		config.SetDefaults()
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, 20.0, measurement.Samples[0].Value)
+		}
+		assert.Equal(t, uint64(0), c.GetStatistics().StaleSamples)
+	})
+
+	t.Run("UsesMaxAgeOfSampleConfigOverConfig", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-10*time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		config := apiv1.Config{MaxAge: time.Hour}
+
+		// act
+		_, err := c.GetSample(config, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, MaxAge: 5 * time.Minute})
+
+		assert.True(t, errors.Is(err, ErrStaleReading))
+
+		_, err = c.GetSample(config, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature})
+		assert.Nil(t, err)
+	})
+
+	t.Run("UsesLastSeenForDeviceValues", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-2*time.Hour), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		// act
+		_, err := c.GetSample(apiv1.Config{MaxAge: time.Hour}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeRSSI})
+
+		assert.True(t, errors.Is(err, ErrStaleReading))
+	})
+}
+
+func TestAggregation(t *testing.T) {
+	t.Run("AggregatesReadingsSincePreviousMeasurement", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Mean", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, Aggregation: apiv1.AggregationMean},
+				{SampleName: "Max", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, Aggregation: apiv1.AggregationMax},
+				{SampleName: "Count", ValueMultiplier: 10, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, Aggregation: apiv1.AggregationCount},
+				{SampleName: "Last", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature},
+			},
+		}
+		_, _, err := c.GetMeasurement(config)
+		assert.Nil(t, err)
+
+		c.handleLine(now.Add(2*time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 000834")
+		c.handleLine(now.Add(4*time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 00076C")
+		now = now.Add(5 * time.Minute)
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		values := map[string]float64{}
+		for _, sample := range measurement.Samples {
+			values[sample.SampleName] = sample.Value
+		}
+		assert.Equal(t, map[string]float64{"Mean": 20, "Max": 21, "Count": 2, "Last": 19}, values)
+	})
+
+	t.Run("IncludesReadingsOfZoneThatWasUnavailableInBetween", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Max", ValueMultiplier: 1, ThermostatID: "01:145038/02", ValueType: apiv1.ValueTypeSetpoint, Aggregation: apiv1.AggregationMax},
+			},
+		}
+		_, _, err := c.GetMeasurement(config)
+		assert.Nil(t, err)
+
+		c.handleLine(now.Add(time.Minute), "045  I --- 01:145038 --:------ 01:145038 2309 003 020834")
+		c.handleLine(now.Add(2*time.Minute), "045  I --- 01:145038 --:------ 01:145038 2309 003 027FFF")
+		c.handleLine(now.Add(3*time.Minute), "045  I --- 01:145038 --:------ 01:145038 2309 003 020708")
+		now = now.Add(5 * time.Minute)
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, 21.0, measurement.Samples[0].Value)
+		}
+	})
+
+	t.Run("AggregatesOnlyZoneOfLatestReadingWithoutZoneIndex", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Max", ValueMultiplier: 1, ThermostatID: "01:145038", ValueType: apiv1.ValueTypeSetpoint, Aggregation: apiv1.AggregationMax},
+			},
+		}
+		_, _, err := c.GetMeasurement(config)
+		assert.Nil(t, err)
+
+		c.handleLine(now.Add(time.Minute), "045  I --- 01:145038 --:------ 01:145038 2309 003 0009C4")
+		c.handleLine(now.Add(2*time.Minute), "045  I --- 01:145038 --:------ 01:145038 2309 003 020708")
+		now = now.Add(5 * time.Minute)
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, 18.0, measurement.Samples[0].Value)
+		}
 	})
+
+	t.Run("SkipsWindowWithMoreReadingsThanKept", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Mean", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, Aggregation: apiv1.AggregationMean},
+			},
+		}
+		_, _, err := c.GetMeasurement(config)
+		assert.Nil(t, err)
+
+		for i := 1; i <= historySize+1; i++ {
+			c.handleLine(now.Add(time.Duration(i)*time.Second), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		}
+		now = now.Add(5 * time.Minute)
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(measurement.Samples))
+	})
+
+	t.Run("UsesValueAtStartOfWindowWithoutNewReadings", func(t *testing.T) {
+
+		c := newTestClient(t)
+		now := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.handleLine(now.Add(-time.Minute), "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		config := apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Weighted", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature, Aggregation: apiv1.AggregationTimeWeightedMean},
+			},
+		}
+		_, _, err := c.GetMeasurement(config)
+		assert.Nil(t, err)
+		now = now.Add(5 * time.Minute)
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, 20.0, measurement.Samples[0].Value)
+		}
+	})
+}
+
+func TestRequest(t *testing.T) {
+	t.Run("ReturnsMatchingReply", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		go func() {
+			<-connection.written
+			// replies of other devices or with other opcodes are ignored
+			connection.writeLine("045 RP --- 01:222222 18:013393 --:------ 0418 022 000000B0000000000000000000007FFFFF7000000000")
+			connection.writeLine("045 RP --- 01:145038 18:013393 --:------ 2309 003 0107D0")
+			connection.writeLine("045 RP --- 01:145038 18:013393 --:------ 0418 022 000001B0040204000000A594B3C780FFFF700010DAF9")
+		}()
+
+		// act
+		reply, err := c.Request(ctx, "01:145038", protocol.OpcodeFaultLog, []byte{0x00, 0x00, 0x01})
+
+		assert.Nil(t, err)
+		if assert.NotNil(t, reply) {
+			assert.Equal(t, "045 RP --- 01:145038 18:013393 --:------ 0418 022 000001B0040204000000A594B3C780FFFF700010DAF9", reply.Raw)
+		}
+	})
+
+	t.Run("RetriesWhenNoReplyArrives", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		c.commandTimeout = 20 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		written := make(chan string, 10)
+		go func() {
+			written <- <-connection.written
+			written <- <-connection.written
+			connection.writeLine("045 RP --- 01:145038 18:013393 --:------ 2309 003 0107D0")
+		}()
+
+		// act
+		reply, err := c.Request(ctx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x01})
+
+		assert.Nil(t, err)
+		assert.NotNil(t, reply)
+		assert.Equal(t, "RQ --- 18:000730 01:145038 --:------ 2309 001 01\r\n", <-written)
+		assert.Equal(t, "RQ --- 18:000730 01:145038 --:------ 2309 001 01\r\n", <-written)
+	})
+
+	t.Run("ReturnsErrorAfterLastAttempt", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		c.commandTimeout = 5 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		<-transport.connections
+
+		// act
+		_, err := c.Request(ctx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x01})
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "failed after 3 attempts")
+	})
+
+	t.Run("NeverWritesRequestCancelledWhileQueued", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		firstReply := make(chan error, 1)
+		go func() {
+			_, err := c.Request(ctx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x01})
+			firstReply <- err
+		}()
+		assert.Equal(t, "RQ --- 18:000730 01:145038 --:------ 2309 001 01\r\n", <-connection.written)
+		cancelledCtx, cancelQueued := context.WithCancel(ctx)
+		queuedReply := make(chan error, 1)
+		go func() {
+			_, err := c.Request(cancelledCtx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x02})
+			queuedReply <- err
+		}()
+		for len(c.commands) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// act
+		cancelQueued()
+
+		assert.Equal(t, context.Canceled, <-queuedReply)
+		connection.writeLine("045 RP --- 01:145038 18:013393 --:------ 2309 003 0107D0")
+		assert.Nil(t, <-firstReply)
+		written := make(chan string, 1)
+		go func() {
+			written <- <-connection.written
+			connection.writeLine("045 RP --- 01:145038 18:013393 --:------ 2309 003 0307D0")
+		}()
+		_, err := c.Request(ctx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x03})
+		assert.Nil(t, err)
+		// the next request is the first thing written after the one that got answered
+		assert.Equal(t, "RQ --- 18:000730 01:145038 --:------ 2309 001 03\r\n", <-written)
+	})
+
+	t.Run("ReturnsErrorWhenContextIsCancelled", func(t *testing.T) {
+
+		c := newTestClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		_, err := c.Request(ctx, "01:145038", protocol.OpcodeZoneSetpoint, []byte{0x01})
+
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestSetZoneSetpoint(t *testing.T) {
+	t.Run("WritesSetpointAndWaitsForBroadcast", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		written := make(chan string, 1)
+		go func() {
+			written <- <-connection.written
+			// a broadcast with the old setpoint doesn't confirm the change
+			connection.writeLine("045  I --- 01:145038 --:------ 01:145038 2309 006 0007D00207D0")
+			connection.writeLine("045  I --- 01:145038 --:------ 01:145038 2309 006 0007D002079E")
+		}()
+
+		// act
+		err := c.SetZoneSetpoint(ctx, "01:145038", 2, 19.5)
+
+		assert.Nil(t, err)
+		assert.Equal(t, " W --- 18:000730 01:145038 --:------ 2309 003 02079E\r\n", <-written)
+	})
+
+	t.Run("IgnoresBroadcastsOfOtherZonesSetpointsAndControllers", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		go func() {
+			<-connection.written
+			// zone 01 at 19.5, zone 02 at 19.4 and zone 02 at 19.5 from another controller
+			connection.writeLine("045  I --- 01:145038 --:------ 01:145038 2309 006 01079E020794")
+			connection.writeLine("045  I --- 01:222222 --:------ 01:222222 2309 003 02079E")
+		}()
+		setCtx, setCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer setCancel()
+
+		// act
+		err := c.SetZoneSetpoint(setCtx, "01:145038", 2, 19.5)
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("KeepsWaitingForBroadcastAfterLastAttemptUntilContextIsDone", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		c.commandTimeout = 5 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		go func() {
+			for i := 0; i < c.commandAttempts; i++ {
+				<-connection.written
+			}
+			// the controller confirms well after the last attempt timed out
+			time.Sleep(20 * time.Millisecond)
+			connection.writeLine("045  I --- 01:145038 --:------ 01:145038 2309 003 02079E")
+		}()
+		setCtx, setCancel := context.WithTimeout(ctx, time.Second)
+		defer setCancel()
+
+		// act
+		err := c.SetZoneSetpoint(setCtx, "01:145038", 2, 19.5)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsErrorForInvalidSetpoint", func(t *testing.T) {
+
+		c := newTestClient(t)
+
+		// act
+		err := c.SetZoneSetpoint(context.Background(), "01:145038", 2, 50)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestSetSystemMode(t *testing.T) {
+	t.Run("WritesModeAndWaitsForBroadcast", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		connection := <-transport.connections
+		written := make(chan string, 1)
+		go func() {
+			written <- <-connection.written
+			connection.writeLine("045  I --- 01:145038 --:------ 01:145038 2E04 008 03FFFFFFFFFFFF00")
+		}()
+
+		// act
+		err := c.SetSystemMode(ctx, "01:145038", protocol.SystemModeAway, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, " W --- 18:000730 01:145038 --:------ 2E04 008 03FFFFFFFFFFFF00\r\n", <-written)
+	})
+
+	t.Run("ReturnsErrorWhenModeIsNotConfirmed", func(t *testing.T) {
+
+		transport := newFakeTransport(0)
+		c := newListenTestClient(t, transport)
+		c.commandTimeout = 5 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Listen(ctx)
+		<-transport.connections
+
+		setCtx, setCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer setCancel()
+
+		// act
+		err := c.SetSystemMode(setCtx, "01:145038", protocol.SystemModeAway, nil)
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func newListenTestClient(t *testing.T, transport Transport) *client {
+	c, err := NewClient(transport, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := c.(*client)
+	cl.minReconnectBackoff = time.Millisecond
+	cl.maxReconnectBackoff = 5 * time.Millisecond
+
+	return cl
+}
+
+func readStatuses(c *client) (statuses []Status) {
+	for status := range c.Status() {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// fakeTransport fails the first openErrors opens and publishes every opened connection
+type fakeTransport struct {
+	mutex       sync.Mutex
+	openErrors  int
+	connections chan *fakeConnection
+}
+
+func newFakeTransport(openErrors int) *fakeTransport {
+	return &fakeTransport{
+		openErrors:  openErrors,
+		connections: make(chan *fakeConnection, 10),
+	}
+}
+
+func (t *fakeTransport) Open() (io.ReadWriteCloser, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.openErrors > 0 {
+		t.openErrors--
+		return nil, fmt.Errorf("No such device")
+	}
+
+	reader, writer := io.Pipe()
+	connection := &fakeConnection{
+		reader:  reader,
+		writer:  writer,
+		closed:  make(chan struct{}),
+		written: make(chan string, 10),
+	}
+	t.connections <- connection
+
+	return connection, nil
+}
+
+func (t *fakeTransport) String() string {
+	return "fake://antenna"
+}
+
+type fakeConnection struct {
+	reader    *io.PipeReader
+	writer    *io.PipeWriter
+	closed    chan struct{}
+	closeOnce sync.Once
+	written   chan string
+}
+
+func (c *fakeConnection) Read(p []byte) (n int, err error) {
+	return c.reader.Read(p)
+}
+
+func (c *fakeConnection) Write(p []byte) (n int, err error) {
+	select {
+	case c.written <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+func (c *fakeConnection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return c.reader.Close()
+}
+
+func (c *fakeConnection) writeLine(line string) {
+	c.writer.Write([]byte(line + "\r\n"))
+}
+
+func (c *fakeConnection) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,179 @@
+package antenna
+
+import (
+	"fmt"
+	"sync"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+const controllerDeviceType = "01"
+
+// DeviceFilter decides whether a frame belongs to the own heating system
+type DeviceFilter interface {
+	Allow(frame *protocol.Frame) bool
+	AllowUponor(frame *protocol.UponorFrame) bool
+	Controller() protocol.Address
+}
+
+// NewDeviceFilter returns a DeviceFilter for the config, or nil if the config has no device filter settings
+func NewDeviceFilter(config apiv1.Config) (DeviceFilter, error) {
+	if !config.DeviceFilter.IsEnabled() {
+		return nil, nil
+	}
+
+	f := &deviceFilter{
+		learn:         config.DeviceFilter.Learn,
+		allowed:       map[protocol.Address]bool{},
+		thermostats:   map[protocol.Address]bool{},
+		foreign:       map[protocol.Address]bool{},
+		uponorSystems: map[uint16]bool{},
+	}
+
+	for _, allowed := range config.DeviceFilter.Allowlist {
+		if protocol.Address(allowed).IsUponor() {
+			address, err := protocol.ParseUponorAddress(allowed)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid device filter allowlist: %w", err)
+			}
+			f.allowUponorSystem(address)
+			continue
+		}
+		address, err := protocol.ParseAddress(allowed)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid device filter allowlist: %w", err)
+		}
+		f.allowed[address] = true
+	}
+
+	for _, sc := range config.SampleConfigs {
+		address, _, err := parseThermostatID(sc.ThermostatID)
+		if err != nil {
+			return nil, err
+		}
+		if address.IsUponor() {
+			_, err = protocol.ParseUponorAddress(string(address))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid thermostat id: %w", err)
+			}
+			f.allowUponorSystem(address)
+			continue
+		}
+		f.allowed[address] = true
+		f.thermostats[address] = true
+
+		// a controller reporting the zones itself is the controller to lock onto
+		if f.learn && address.DeviceType() == controllerDeviceType {
+			f.controller = address
+		}
+	}
+
+	if config.DeviceFilter.ControllerID != "" {
+		address, err := protocol.ParseAddress(config.DeviceFilter.ControllerID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid device filter controller id: %w", err)
+		}
+		f.controller = address
+	}
+	if f.controller != "" {
+		f.allowed[f.controller] = true
+	}
+
+	return f, nil
+}
+
+type deviceFilter struct {
+	learn bool
+
+	mutex       sync.RWMutex
+	controller  protocol.Address
+	allowed     map[protocol.Address]bool
+	thermostats map[protocol.Address]bool
+	foreign     map[protocol.Address]bool
+	// uponorSystems holds the system addresses of the own Uponor Smatrix Wave thermostats, which all share the
+	// system address of the controller they're paired with
+	uponorSystems map[uint16]bool
+}
+
+func (f *deviceFilter) allowUponorSystem(address protocol.Address) {
+	if system, ok := address.UponorSystem(); ok {
+		f.uponorSystems[system] = true
+	}
+}
+
+// Allow returns true for frames from allowed devices; devices exchanging frames with the controller get allowed from
+// then on, so the relays and valves bound to it don't need to be listed
+func (f *deviceFilter) Allow(frame *protocol.Frame) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	source := frame.Source()
+
+	if f.controller == "" && f.learn && f.thermostats[source] {
+		for _, address := range frame.Addresses {
+			if address.DeviceType() == controllerDeviceType && address != source {
+				log.Info().Msgf("Learned controller %v from thermostat %v", address, source)
+				f.controller = address
+				f.allowed[address] = true
+				break
+			}
+		}
+	}
+
+	if f.controller != "" && involves(frame, f.controller) {
+		for _, address := range frame.Addresses {
+			if !address.IsEmpty() && !f.allowed[address] {
+				log.Info().Msgf("Allowing device %v bound to controller %v", address, f.controller)
+				f.allowed[address] = true
+			}
+		}
+	}
+
+	if f.allowed[source] {
+		return true
+	}
+
+	if !f.foreign[source] {
+		log.Info().Msgf("Ignoring frames from foreign device %v", source)
+		f.foreign[source] = true
+	}
+
+	return false
+}
+
+// AllowUponor returns true for frames of Uponor Smatrix Wave thermostats in the system of a listed or configured
+// thermostat
+func (f *deviceFilter) AllowUponor(frame *protocol.UponorFrame) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.uponorSystems[frame.System] {
+		return true
+	}
+
+	source := frame.Address()
+	if !f.foreign[source] {
+		log.Info().Msgf("Ignoring frames from foreign Uponor thermostat %v", source)
+		f.foreign[source] = true
+	}
+
+	return false
+}
+
+func (f *deviceFilter) Controller() protocol.Address {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.controller
+}
+
+func involves(frame *protocol.Frame, address protocol.Address) bool {
+	for _, a := range frame.Addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package antenna
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeviceFilter(t *testing.T) {
+	t.Run("ReturnsNilWithoutFilterSettings", func(t *testing.T) {
+
+		// act
+		filter, err := NewDeviceFilter(apiv1.Config{SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "34:092243"}}})
+
+		assert.Nil(t, err)
+		assert.Nil(t, filter)
+	})
+
+	t.Run("ReturnsErrorForInvalidAllowlistAddress", func(t *testing.T) {
+
+		// act
+		_, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Allowlist: []string{"13:10603"}}})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForInvalidControllerID", func(t *testing.T) {
+
+		// act
+		_, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{ControllerID: "controller"}})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestAllow(t *testing.T) {
+	t.Run("AllowsListedAndConfiguredDevicesOnly", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "34:092243"}},
+			DeviceFilter:  apiv1.DeviceFilterConfig{Allowlist: []string{"13:106039"}},
+		})
+		assert.Nil(t, err)
+
+		// act
+		assert.True(t, filter.Allow(mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")))
+		assert.True(t, filter.Allow(mustParseFrame(t, "045  I --- 13:106039 --:------ 13:106039 3EF0 003 00C8FF")))
+		assert.False(t, filter.Allow(mustParseFrame(t, "045  I --- 34:111111 --:------ 34:111111 30C9 003 0007D0")))
+	})
+
+	t.Run("AllowsDevicesOnceTheyExchangeFramesWithTheController", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{ControllerID: "01:145038"}})
+		assert.Nil(t, err)
+		relayBroadcast := mustParseFrame(t, "045  I --- 13:106039 --:------ 13:106039 3EF0 003 00C8FF")
+
+		// act
+		assert.True(t, filter.Allow(mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0")))
+		assert.False(t, filter.Allow(relayBroadcast))
+		assert.True(t, filter.Allow(mustParseFrame(t, "045 RQ --- 01:145038 13:106039 --:------ 3EF0 001 00")))
+		assert.True(t, filter.Allow(relayBroadcast))
+		assert.False(t, filter.Allow(mustParseFrame(t, "045  I --- 01:999999 --:------ 01:999999 30C9 003 0007D0")))
+	})
+
+	t.Run("LearnsControllerTheConfiguredThermostatsTalkTo", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "34:092243"}},
+			DeviceFilter:  apiv1.DeviceFilterConfig{Learn: true},
+		})
+		assert.Nil(t, err)
+		controllerBroadcast := mustParseFrame(t, "045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0")
+
+		// act
+		assert.False(t, filter.Allow(controllerBroadcast))
+		assert.True(t, filter.Allow(mustParseFrame(t, "045  I --- 34:092243 01:145038 --:------ 30C9 003 0007D0")))
+
+		assert.Equal(t, protocol.Address("01:145038"), filter.Controller())
+		assert.True(t, filter.Allow(controllerBroadcast))
+		assert.False(t, filter.Allow(mustParseFrame(t, "045  I --- 01:999999 --:------ 01:999999 30C9 003 0007D0")))
+	})
+
+	t.Run("LocksOntoConfiguredControllerInLearnMode", func(t *testing.T) {
+
+		// act
+		filter, err := NewDeviceFilter(apiv1.Config{
+			SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "01:145038/02"}},
+			DeviceFilter:  apiv1.DeviceFilterConfig{Learn: true},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, protocol.Address("01:145038"), filter.Controller())
+	})
+}
+
+func TestAllowUponor(t *testing.T) {
+	t.Run("AllowsThermostatsInSystemOfConfiguredThermostatsOnly", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Learn: true}, SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "uponor:110B:DE13"}}})
+		assert.Nil(t, err)
+
+		// act
+		assert.True(t, filter.AllowUponor(&protocol.UponorFrame{System: 0x110B, Device: 0xDE13}))
+		assert.True(t, filter.AllowUponor(&protocol.UponorFrame{System: 0x110B, Device: 0x4A21}))
+		assert.False(t, filter.AllowUponor(&protocol.UponorFrame{System: 0x120B, Device: 0x4A21}))
+	})
+
+	t.Run("AllowsThermostatsInSystemOfAllowlistedThermostat", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Allowlist: []string{"uponor:120B:4A21"}}})
+		assert.Nil(t, err)
+
+		// act
+		assert.True(t, filter.AllowUponor(&protocol.UponorFrame{System: 0x120B, Device: 0x4A21}))
+		assert.False(t, filter.AllowUponor(&protocol.UponorFrame{System: 0x110B, Device: 0xDE13}))
+	})
+
+	t.Run("ReturnsErrorForInvalidUponorAddress", func(t *testing.T) {
+
+		// act
+		_, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Allowlist: []string{"uponor:120B"}}})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestHandleLineWithDeviceFilter(t *testing.T) {
+	t.Run("DropsAndCountsForeignFrames", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Allowlist: []string{"34:092243"}}})
+		assert.Nil(t, err)
+		antennaClient, err := NewClient(&serialTransport{devicePath: "/dev/ttyUSB0"}, nil, filter)
+		assert.Nil(t, err)
+		c := antennaClient.(*client)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+
+		// act
+		c.handleLine(receivedTime, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+		c.handleLine(receivedTime, "045  I --- 34:111111 --:------ 34:111111 30C9 003 000834")
+
+		statistics := c.GetStatistics()
+		assert.Equal(t, uint64(1), statistics.ForeignFrames)
+		assert.Equal(t, map[protocol.Opcode]uint64{"30C9": 1}, statistics.FramesReceived)
+		_, _, foreignErr := c.getReading("34:111111", apiv1.ValueTypeTemperature)
+		assert.NotNil(t, foreignErr)
+		assert.Equal(t, 1, len(c.GetDevices()))
+	})
+
+	t.Run("DropsAndCountsForeignUponorFrames", func(t *testing.T) {
+
+		filter, err := NewDeviceFilter(apiv1.Config{DeviceFilter: apiv1.DeviceFilterConfig{Learn: true}, SampleConfigs: []apiv1.ConfigSample{{ThermostatID: "uponor:110B:DE13"}}})
+		assert.Nil(t, err)
+		antennaClient, err := NewClient(&serialTransport{devicePath: "/dev/ttyUSB0"}, nil, filter)
+		assert.Nil(t, err)
+		c := antennaClient.(*client)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+
+		// act
+		c.handleLine(receivedTime, "045 110BDE134002B1772D")
+		c.handleLine(receivedTime, "045 120B4A214002B17B48")
+
+		statistics := c.GetStatistics()
+		assert.Equal(t, uint64(1), statistics.ForeignFrames)
+		assert.Equal(t, map[protocol.Opcode]uint64{protocol.OpcodeUponor: 1}, statistics.FramesReceived)
+		_, _, foreignErr := c.getReading("uponor:120B:4A21", apiv1.ValueTypeTemperature)
+		assert.NotNil(t, foreignErr)
+		if assert.Equal(t, 1, len(c.GetDevices())) {
+			assert.Equal(t, protocol.Address("uponor:110B:DE13"), c.GetDevices()[0].Address)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package antenna
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+)
+
+// Recorder writes every received line to a capture file to be able to reproduce decoding issues
+type Recorder interface {
+	Record(receivedTime time.Time, raw string, frame *protocol.Frame, parseErr error) (err error)
+	Close() (err error)
+}
+
+// CaptureRecord is a single line in a capture file
+type CaptureRecord struct {
+	Timestamp time.Time      `json:"ts"`
+	Raw       string         `json:"raw"`
+	Parsed    *CapturedFrame `json:"parsed"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// CapturedFrame is the json representation of protocol.Frame with the payload as hex
+type CapturedFrame struct {
+	RSSI        int    `json:"rssi"`
+	Verb        string `json:"verb"`
+	Sequence    int    `json:"sequence"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Opcode      string `json:"opcode"`
+	Length      int    `json:"length"`
+	Payload     string `json:"payload"`
+}
+
+// NewRecorder returns a Recorder that rotates the capture file once it exceeds maxSizeBytes and keeps maxBackups old files
+func NewRecorder(path string, maxSizeBytes int64, maxBackups int) (Recorder, error) {
+	if path == "" {
+		return nil, fmt.Errorf("Please set the path for the capture file")
+	}
+	if maxSizeBytes <= 0 {
+		return nil, fmt.Errorf("Please set a maximum capture file size larger than 0")
+	}
+
+	r := &recorder{
+		path:         path,
+		maxSizeBytes: maxSizeBytes,
+		maxBackups:   maxBackups,
+	}
+
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type recorder struct {
+	path         string
+	maxSizeBytes int64
+	maxBackups   int
+
+	mutex sync.Mutex
+	f     *os.File
+	size  int64
+}
+
+func (r *recorder) Record(receivedTime time.Time, raw string, frame *protocol.Frame, parseErr error) (err error) {
+
+	record := CaptureRecord{
+		Timestamp: receivedTime,
+		Raw:       raw,
+	}
+	if frame != nil {
+		record.Parsed = &CapturedFrame{
+			RSSI:        frame.RSSI,
+			Verb:        string(frame.Verb),
+			Sequence:    frame.Sequence,
+			Source:      frame.Source().String(),
+			Destination: frame.Destination().String(),
+			Opcode:      string(frame.Opcode),
+			Length:      frame.Length,
+			Payload:     hex.EncodeToString(frame.Payload),
+		}
+	}
+	if parseErr != nil {
+		record.Error = parseErr.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.f == nil {
+		return fmt.Errorf("Capture file %v is closed", r.path)
+	}
+
+	if r.size > 0 && r.size+int64(len(data)) > r.maxSizeBytes {
+		err = r.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := r.f.Write(data)
+	r.size += int64(n)
+
+	return err
+}
+
+func (r *recorder) Close() (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+
+	err = r.f.Close()
+	r.f = nil
+
+	return err
+}
+
+func (r *recorder) open() (err error) {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed opening capture file %v: %w", r.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("Failed retrieving size of capture file %v: %w", r.path, err)
+	}
+
+	r.f = f
+	r.size = info.Size()
+
+	return nil
+}
+
+// rotate renames capture.jsonl to capture.jsonl.1, capture.jsonl.1 to capture.jsonl.2 and so on, removing the oldest
+func (r *recorder) rotate() (err error) {
+	err = r.f.Close()
+	if err != nil {
+		return err
+	}
+	r.f = nil
+
+	if r.maxBackups <= 0 {
+		err = os.Remove(r.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	for i := r.maxBackups; i > 0; i-- {
+		source := r.path
+		if i > 1 {
+			source = fmt.Sprintf("%v.%v", r.path, i-1)
+		}
+		err = os.Rename(source, fmt.Sprintf("%v.%v", r.path, i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return r.open()
+}
@@ -0,0 +1,89 @@
+package antenna
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	t.Run("WritesValidAndInvalidLinesAsJSON", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "recorder")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.jsonl")
+		recorder, err := NewRecorder(path, 1024*1024, 2)
+		assert.Nil(t, err)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		frame := mustParseFrame(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		// act
+		err = recorder.Record(receivedTime, frame.Raw, frame, nil)
+		assert.Nil(t, err)
+		err = recorder.Record(receivedTime, "# evofw3 0.7.0", nil, fmt.Errorf("Invalid frame"))
+		assert.Nil(t, err)
+		recorder.Close()
+
+		records := readCaptureRecords(t, path)
+		if assert.Equal(t, 2, len(records)) {
+			assert.Equal(t, receivedTime, records[0].Timestamp)
+			assert.Equal(t, "30C9", records[0].Parsed.Opcode)
+			assert.Equal(t, "34:092243", records[0].Parsed.Source)
+			assert.Equal(t, "0007d0", records[0].Parsed.Payload)
+			assert.Empty(t, records[0].Error)
+			assert.Equal(t, "# evofw3 0.7.0", records[1].Raw)
+			assert.Nil(t, records[1].Parsed)
+			assert.Equal(t, "Invalid frame", records[1].Error)
+		}
+	})
+
+	t.Run("RotatesFileWhenExceedingMaximumSize", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "recorder")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.jsonl")
+		recorder, err := NewRecorder(path, 100, 2)
+		assert.Nil(t, err)
+
+		// act
+		for i := 0; i < 5; i++ {
+			err = recorder.Record(time.Now().UTC(), fmt.Sprintf("line %v with enough characters to fill up", i), nil, nil)
+			assert.Nil(t, err)
+		}
+		recorder.Close()
+
+		assert.Equal(t, "line 4 with enough characters to fill up", readCaptureRecords(t, path)[0].Raw)
+		assert.Equal(t, "line 3 with enough characters to fill up", readCaptureRecords(t, path+".1")[0].Raw)
+		assert.Equal(t, "line 2 with enough characters to fill up", readCaptureRecords(t, path+".2")[0].Raw)
+		_, err = os.Stat(path + ".3")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func readCaptureRecords(t *testing.T, path string) (records []CaptureRecord) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
@@ -0,0 +1,80 @@
+package antenna
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/state"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/google/uuid"
+)
+
+// ReplayClient decodes lines from a capture file instead of the antenna; its clock follows the replayed time so
+// measurements get the time they would have had in live mode
+type ReplayClient interface {
+	SetTime(replayTime time.Time)
+	HandleLine(raw string)
+	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error)
+	GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error)
+}
+
+// NewReplayClient returns new antenna.ReplayClient; filter is optional and can be nil
+func NewReplayClient(filter DeviceFilter) (ReplayClient, error) {
+	stateClient, err := state.NewClient(historySize)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &replayClient{
+		client: client{
+			filter:           filter,
+			framesReceived:   map[protocol.Opcode]uint64{},
+			state:            stateClient,
+			devices:          map[protocol.Address]*Device{},
+			broadcastTimings: map[broadcastKey]*broadcastTiming{},
+			batteryWarnings:  map[protocol.Address]time.Time{},
+		},
+	}
+	c.now = func() time.Time { return c.replayTime }
+
+	return c, nil
+}
+
+type replayClient struct {
+	client
+	replayTime time.Time
+}
+
+func (c *replayClient) SetTime(replayTime time.Time) {
+	c.replayTime = replayTime.UTC()
+}
+
+func (c *replayClient) HandleLine(raw string) {
+	c.handleLine(c.replayTime, raw)
+}
+
+// GetMeasurement derives the measurement id from the location and replayed time instead of generating a random one, so
+// replaying the same capture again yields the same ids and bigquery can deduplicate the backfilled rows
+func (c *replayClient) GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error) {
+	measurement, sampleConfigs, err = c.client.GetMeasurement(config)
+	measurement.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("jarvis-uponor-smatrix-exporter/%v/%v", config.Location, measurement.MeasuredAtTime.Format(time.RFC3339Nano)))).String()
+
+	return
+}
+
+// ParseCaptureLine reads a line from a capture file written by the Recorder; plain antenna lines are supported as well
+// and get a zero timestamp, so a replay places them at the time of the previous timestamped line
+func ParseCaptureLine(line string) (record CaptureRecord, err error) {
+	if len(line) == 0 || line[0] != '{' {
+		return CaptureRecord{Raw: line}, nil
+	}
+
+	if err = json.Unmarshal([]byte(line), &record); err != nil {
+		return record, fmt.Errorf("Failed unmarshalling capture line %v: %w", line, err)
+	}
+
+	return record, nil
+}
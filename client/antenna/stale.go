@@ -0,0 +1,120 @@
+package antenna
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrStaleReading is returned for samples whose reading is older than the max age of the sample config
+var ErrStaleReading = errors.New("Reading is older than its max age")
+
+// CheckAge returns an error wrapping ErrStaleReading if the reading received at receivedTime is older than the max age
+// of the sample config; a max age of 0 accepts readings of any age
+func CheckAge(config apiv1.Config, sampleConfig apiv1.ConfigSample, receivedTime, now time.Time) error {
+	maxAge := sampleConfig.MaxAge
+	if maxAge == 0 {
+		maxAge = config.MaxAge
+	}
+	if maxAge <= 0 {
+		return nil
+	}
+
+	age := now.Sub(receivedTime)
+	if age > maxAge {
+		return fmt.Errorf("The %v reading of thermostat %v is %v old: %w", sampleConfig.ValueType, sampleConfig.ThermostatID, age.Round(time.Second), ErrStaleReading)
+	}
+
+	return nil
+}
+
+// StaleTracker counts the samples omitted from measurements for being stale and logs when a thermostat goes quiet or
+// starts sending again; a thermostat only counts as quiet when all of its value types are stale, since some values,
+// like the setpoint, are broadcast far less often than others
+type StaleTracker struct {
+	mutex        sync.Mutex
+	staleSamples uint64
+	stale        map[string]map[apiv1.ValueType]bool
+	quiet        map[string]bool
+}
+
+// Update records the result of getting the sample of a value type for a thermostat and returns true if the sample is
+// stale; call UpdateQuiet once all samples of a measurement are recorded
+func (t *StaleTracker) Update(thermostatID string, valueType apiv1.ValueType, err error) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stale == nil {
+		t.stale = map[string]map[apiv1.ValueType]bool{}
+	}
+	if t.stale[thermostatID] == nil {
+		t.stale[thermostatID] = map[apiv1.ValueType]bool{}
+	}
+
+	if err != nil && errors.Is(err, ErrStaleReading) {
+		log.Debug().Err(err).Msgf("Omitting stale %v sample of thermostat %v", valueType, thermostatID)
+		t.staleSamples++
+		t.stale[thermostatID][valueType] = true
+		return true
+	}
+
+	if err == nil {
+		t.stale[thermostatID][valueType] = false
+	}
+
+	return false
+}
+
+// UpdateQuiet marks the thermostats whose value types are all stale as quiet and logs the thermostats that went quiet
+// or started sending again
+func (t *StaleTracker) UpdateQuiet() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.quiet == nil {
+		t.quiet = map[string]bool{}
+	}
+
+	for thermostatID, valueTypes := range t.stale {
+		quiet := len(valueTypes) > 0
+		for _, stale := range valueTypes {
+			quiet = quiet && stale
+		}
+
+		if quiet && !t.quiet[thermostatID] {
+			log.Warn().Msgf("Thermostat %v went quiet, omitting its samples until it sends again", thermostatID)
+			t.quiet[thermostatID] = true
+		}
+		if !quiet && t.quiet[thermostatID] {
+			log.Info().Msgf("Thermostat %v is sending again", thermostatID)
+			delete(t.quiet, thermostatID)
+		}
+	}
+}
+
+// StaleSamples returns the number of samples omitted for being stale
+func (t *StaleTracker) StaleSamples() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.staleSamples
+}
+
+// QuietThermostats returns the sorted ids of the thermostats whose samples were all stale in the last measurement
+func (t *StaleTracker) QuietThermostats() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	thermostatIDs := []string{}
+	for thermostatID := range t.quiet {
+		thermostatIDs = append(thermostatIDs, thermostatID)
+	}
+	sort.Strings(thermostatIDs)
+
+	return thermostatIDs
+}
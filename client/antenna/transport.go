@@ -0,0 +1,193 @@
+package antenna
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+// Transport opens the connection over which the antenna sends its lines
+type Transport interface {
+	Open() (io.ReadWriteCloser, error)
+	String() string
+}
+
+// NewTransport returns the Transport for urls like serial:///dev/ttyUSB0, tcp://host:port or file://capture.log; a url
+// without scheme is used as serial device path
+func NewTransport(antennaURL string) (Transport, error) {
+	if antennaURL == "" {
+		return nil, fmt.Errorf("Please set the url or usb device path for the antenna")
+	}
+
+	if !strings.Contains(antennaURL, "://") {
+		return &serialTransport{devicePath: antennaURL}, nil
+	}
+
+	u, err := url.Parse(antennaURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed parsing antenna url %v: %w", antennaURL, err)
+	}
+
+	switch u.Scheme {
+	case "serial":
+		if u.Path == "" {
+			return nil, fmt.Errorf("Antenna url %v has no device path", antennaURL)
+		}
+		return &serialTransport{devicePath: u.Path}, nil
+
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("Antenna url %v has no port", antennaURL)
+		}
+		return &tcpTransport{address: u.Host}, nil
+
+	case "file":
+		// support both relative file://capture.log and absolute file:///tmp/capture.log paths
+		path := u.Host + u.Path
+		if path == "" {
+			return nil, fmt.Errorf("Antenna url %v has no file path", antennaURL)
+		}
+		return &fileTransport{path: path}, nil
+	}
+
+	return nil, fmt.Errorf("Antenna url %v has unsupported scheme %v, use serial, tcp or file", antennaURL, u.Scheme)
+}
+
+type serialTransport struct {
+	devicePath string
+}
+
+func (t *serialTransport) Open() (io.ReadWriteCloser, error) {
+	options := serial.OpenOptions{
+		PortName:               t.devicePath,
+		BaudRate:               16550,
+		DataBits:               8,
+		StopBits:               1,
+		MinimumReadSize:        0,
+		InterCharacterTimeout:  2000,
+		ParityMode:             serial.PARITY_NONE,
+		Rs485Enable:            false,
+		Rs485RtsHighDuringSend: false,
+		Rs485RtsHighAfterSend:  false,
+	}
+
+	f, err := serial.Open(options)
+	if err != nil {
+		return nil, fmt.Errorf("Failed opening serial device %v: %w", t.devicePath, err)
+	}
+
+	return f, nil
+}
+
+func (t *serialTransport) String() string {
+	return "serial://" + t.devicePath
+}
+
+// tcpTransport connects to a serial-to-network gateway like ser2net or an ESP based antenna
+type tcpTransport struct {
+	address string
+}
+
+func (t *tcpTransport) Open() (io.ReadWriteCloser, error) {
+	conn, err := net.DialTimeout("tcp", t.address, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("Failed connecting to %v: %w", t.address, err)
+	}
+
+	return &tcpConnection{Conn: conn, address: t.address}, nil
+}
+
+func (t *tcpTransport) String() string {
+	return "tcp://" + t.address
+}
+
+// tcpConnection turns EOF into an error, because unlike for a serial port it means the gateway closed the connection
+type tcpConnection struct {
+	net.Conn
+	address string
+}
+
+func (c *tcpConnection) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if err == io.EOF {
+		return n, fmt.Errorf("Connection closed by %v: %w", c.address, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// fileTransport replays lines from a file once; after the last line the connection stays silent until closed, like an
+// antenna that doesn't receive anything anymore
+type fileTransport struct {
+	path string
+
+	mutex    sync.Mutex
+	replayed bool
+}
+
+func (t *fileTransport) Open() (io.ReadWriteCloser, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	conn := &fileConnection{
+		closed: make(chan struct{}),
+	}
+
+	// reopening after a reset should not replay the same lines again
+	if t.replayed {
+		return conn, nil
+	}
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed opening replay file %v: %w", t.path, err)
+	}
+	conn.f = f
+	t.replayed = true
+
+	return conn, nil
+}
+
+func (t *fileTransport) String() string {
+	return "file://" + t.path
+}
+
+type fileConnection struct {
+	f         *os.File
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *fileConnection) Read(p []byte) (n int, err error) {
+	if c.f != nil {
+		n, err = c.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+	}
+
+	// block like a silent antenna until closed
+	<-c.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (c *fileConnection) Write(p []byte) (n int, err error) {
+	// written frames go nowhere when replaying
+	return len(p), nil
+}
+
+func (c *fileConnection) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.f != nil {
+			err = c.f.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,138 @@
+package antenna
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	t.Run("ReturnsSerialTransportForPathWithoutScheme", func(t *testing.T) {
+
+		// act
+		transport, err := NewTransport("/dev/ttyUSB0")
+
+		assert.Nil(t, err)
+		assert.Equal(t, &serialTransport{devicePath: "/dev/ttyUSB0"}, transport)
+	})
+
+	t.Run("ReturnsSerialTransportForSerialScheme", func(t *testing.T) {
+
+		// act
+		transport, err := NewTransport("serial:///dev/ttyACM0")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "serial:///dev/ttyACM0", transport.String())
+	})
+
+	t.Run("ReturnsTCPTransportForTCPScheme", func(t *testing.T) {
+
+		// act
+		transport, err := NewTransport("tcp://192.168.1.20:5000")
+
+		assert.Nil(t, err)
+		assert.Equal(t, &tcpTransport{address: "192.168.1.20:5000"}, transport)
+	})
+
+	t.Run("ReturnsErrorForTCPSchemeWithoutPort", func(t *testing.T) {
+
+		// act
+		_, err := NewTransport("tcp://192.168.1.20")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsFileTransportForRelativePath", func(t *testing.T) {
+
+		// act
+		transport, err := NewTransport("file://capture.log")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "file://capture.log", transport.String())
+	})
+
+	t.Run("ReturnsFileTransportForAbsolutePath", func(t *testing.T) {
+
+		// act
+		transport, err := NewTransport("file:///tmp/capture.log")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "file:///tmp/capture.log", transport.String())
+	})
+
+	t.Run("ReturnsErrorForUnsupportedScheme", func(t *testing.T) {
+
+		// act
+		_, err := NewTransport("http://localhost")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFileTransport(t *testing.T) {
+	t.Run("ReplaysLinesOnlyOnce", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "antenna")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.log")
+		err = ioutil.WriteFile(path, []byte("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0\r\n"), 0644)
+		assert.Nil(t, err)
+		transport, err := NewTransport("file://" + path)
+		assert.Nil(t, err)
+
+		// act
+		conn, err := transport.Open()
+		assert.Nil(t, err)
+		line, _, err := bufio.NewReader(conn).ReadLine()
+		assert.Nil(t, err)
+		conn.Close()
+
+		reopened, err := transport.Open()
+		assert.Nil(t, err)
+		read := make(chan error)
+		go func() {
+			_, err := reopened.Read(make([]byte, 10))
+			read <- err
+		}()
+		reopened.Close()
+
+		assert.Equal(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0", string(line))
+		assert.NotNil(t, <-read)
+	})
+}
+
+func TestTCPTransport(t *testing.T) {
+	t.Run("ReadsLinesFromGateway", func(t *testing.T) {
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0\r\n"))
+			time.Sleep(100 * time.Millisecond)
+		}()
+		transport, err := NewTransport("tcp://" + listener.Addr().String())
+		assert.Nil(t, err)
+
+		// act
+		conn, err := transport.Open()
+		assert.Nil(t, err)
+		defer conn.Close()
+		line, _, err := bufio.NewReader(conn).ReadLine()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0", string(line))
+	})
+}
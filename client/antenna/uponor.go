@@ -0,0 +1,63 @@
+package antenna
+
+import (
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/rs/zerolog/log"
+)
+
+// handleUponorLine stores the values of an Uponor Smatrix Wave thermostat as the same readings the RAMSES-II frames
+// result in, so sample configs work the same for both; uponor thermostats have a single zone and the device filter
+// drops the ones of other systems
+func (c *client) handleUponorLine(receivedTime time.Time, rawmsg string, frame *protocol.UponorFrame) {
+
+	foreign := c.filter != nil && !c.filter.AllowUponor(frame)
+
+	c.connectionMutex.Lock()
+	c.lastReceivedMessage = receivedTime
+	if foreign {
+		c.foreignFrames++
+	} else {
+		c.lastValidFrame = receivedTime
+		c.framesReceived[protocol.OpcodeUponor]++
+	}
+	c.connectionMutex.Unlock()
+
+	c.record(receivedTime, rawmsg, nil, nil)
+	if foreign {
+		return
+	}
+
+	address := frame.Address()
+	log.Debug().
+		Int("rssi", frame.RSSI).
+		Str("source", address.String()).
+		Int("values", len(frame.Values)).
+		Msgf("uponor: %v", frame.Raw)
+
+	// the thermostats broadcast their values periodically
+	c.updateDevice(address, frame.RSSI, protocol.OpcodeUponor, true, receivedTime)
+
+	thermostat := protocol.DecodeUponorThermostat(frame)
+	if thermostat.RoomTemperature != nil {
+		c.setReading(address, 0, apiv1.ValueTypeTemperature, *thermostat.RoomTemperature, receivedTime)
+	}
+	if thermostat.Setpoint != nil {
+		c.setReading(address, 0, apiv1.ValueTypeSetpoint, *thermostat.Setpoint, receivedTime)
+	}
+	if thermostat.FloorTemperature != nil {
+		c.setReading(address, 0, apiv1.ValueTypeFloorTemperature, *thermostat.FloorTemperature, receivedTime)
+	}
+	if thermostat.Humidity != nil {
+		c.setReading(address, 0, apiv1.ValueTypeHumidity, *thermostat.Humidity, receivedTime)
+	}
+	if thermostat.Demand != nil {
+		demand := 0.0
+		if *thermostat.Demand {
+			demand = 100
+		}
+		c.setReading(address, 0, apiv1.ValueTypeHeatDemand, demand, receivedTime)
+	}
+}
@@ -18,12 +18,21 @@ type Client interface {
 	UpdateTableSchema(dataset, table string, typeForSchema interface{}) (err error)
 	DeleteTable(dataset, table string) (err error)
 	InsertMeasurement(dataset, table string, measurement contractsv1.Measurement) (err error)
+	InsertMeasurements(ctx context.Context, dataset, table string, measurements []contractsv1.Measurement) (err error)
 	InitBigqueryTable(dataset, table string) (err error)
 }
 
 // NewClient returns new bigquery.Client
 func NewClient(projectID string, enable bool) (Client, error) {
 
+	// don't require credentials when bigquery integration is disabled, for example when replaying to stdout
+	if !enable {
+		return &client{
+			projectID: projectID,
+			enable:    enable,
+		}, nil
+	}
+
 	ctx := context.Background()
 
 	bigqueryClient, err := googlebigquery.NewClient(ctx, projectID)
@@ -164,6 +173,12 @@ func (c *client) DeleteTable(dataset, table string) (err error) {
 }
 
 func (c *client) InsertMeasurement(dataset, table string, measurement contractsv1.Measurement) (err error) {
+	return c.InsertMeasurements(context.Background(), dataset, table, []contractsv1.Measurement{measurement})
+}
+
+// InsertMeasurements inserts all measurements in a single request; the measurement id is used as insert id, so
+// bigquery drops rows that are inserted again when retrying
+func (c *client) InsertMeasurements(ctx context.Context, dataset, table string, measurements []contractsv1.Measurement) (err error) {
 
 	if !c.enable {
 		return nil
@@ -173,7 +188,15 @@ func (c *client) InsertMeasurement(dataset, table string, measurement contractsv
 
 	u := tbl.Uploader()
 
-	if err := u.Put(context.Background(), measurement); err != nil {
+	savers := []*googlebigquery.StructSaver{}
+	for _, measurement := range measurements {
+		savers = append(savers, &googlebigquery.StructSaver{
+			Struct:   measurement,
+			InsertID: measurement.ID,
+		})
+	}
+
+	if err := u.Put(ctx, savers); err != nil {
 		return err
 	}
 
@@ -182,6 +205,10 @@ func (c *client) InsertMeasurement(dataset, table string, measurement contractsv
 
 func (c *client) InitBigqueryTable(dataset, table string) (err error) {
 
+	if !c.enable {
+		return nil
+	}
+
 	log.Debug().Msgf("Checking if table %v.%v.%v exists...", c.projectID, dataset, table)
 	tableExist := c.CheckIfTableExists(dataset, table)
 
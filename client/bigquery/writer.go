@@ -0,0 +1,419 @@
+package bigquery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	googlebigquery "cloud.google.com/go/bigquery"
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	foundation "github.com/estafette/estafette-foundation"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	finalFlushTimeout = 30 * time.Second
+)
+
+// Inserter stores a batch of measurements, like Client does
+type Inserter interface {
+	InsertMeasurements(ctx context.Context, dataset, table string, measurements []contractsv1.Measurement) (err error)
+}
+
+// Writer buffers measurements and inserts them in batches
+type Writer interface {
+	Write(measurement contractsv1.Measurement) (err error)
+	Run(ctx context.Context)
+	Flush(ctx context.Context) (err error)
+}
+
+// NewWriter returns new bigquery.Writer; measurements that can't be inserted after retrying are kept in the spool
+// file at spoolPath and inserted with the next flush, so outages don't lose measurements; once the spool holds more than
+// maxSpooled measurements the oldest ones get dropped
+func NewWriter(inserter Inserter, dataset, table string, batchSize int, flushInterval time.Duration, spoolPath string, maxSpooled int) (Writer, error) {
+	if inserter == nil {
+		return nil, fmt.Errorf("Please set the inserter for the bigquery writer")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("Please set a batch size larger than 0")
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("Please set a flush interval larger than 0")
+	}
+	if maxSpooled <= 0 {
+		return nil, fmt.Errorf("Please set a maximum number of spooled measurements larger than 0")
+	}
+
+	return &writer{
+		inserter:              inserter,
+		dataset:               dataset,
+		table:                 table,
+		batchSize:             batchSize,
+		flushInterval:         flushInterval,
+		spoolPath:             spoolPath,
+		maxSpooled:            maxSpooled,
+		retryAttempts:         5,
+		retryDelayMillisecond: 1000,
+		flushRequests:         make(chan struct{}, 1),
+	}, nil
+}
+
+type writer struct {
+	inserter              Inserter
+	dataset               string
+	table                 string
+	batchSize             int
+	flushInterval         time.Duration
+	spoolPath             string
+	maxSpooled            int
+	retryAttempts         uint
+	retryDelayMillisecond int
+	flushRequests         chan struct{}
+
+	// flushMutex makes sure only one flush at a time reads and writes the spool file
+	flushMutex sync.Mutex
+
+	mutex        sync.Mutex
+	buffer       []contractsv1.Measurement
+	lastFlushErr error
+	stopped      bool
+}
+
+// Write buffers the measurement; it returns the error of the previous flush, so a failing bigquery shows up in the
+// scheduler and health checks even though the measurement itself is kept
+func (w *writer) Write(measurement contractsv1.Measurement) (err error) {
+	w.mutex.Lock()
+	stopped := w.stopped
+	if !stopped {
+		w.buffer = append(w.buffer, measurement)
+	}
+	full := len(w.buffer) >= w.batchSize
+	lastFlushErr := w.lastFlushErr
+	w.mutex.Unlock()
+
+	// measurements taken while shutting down no longer get flushed, so spool them for the next start
+	if stopped {
+		w.flushMutex.Lock()
+		defer w.flushMutex.Unlock()
+		return w.spoolAfterStop(measurement)
+	}
+
+	if full {
+		select {
+		case w.flushRequests <- struct{}{}:
+		default:
+		}
+	}
+
+	if lastFlushErr != nil {
+		return fmt.Errorf("Measurement buffered, but last flush to bigquery failed: %w", lastFlushErr)
+	}
+
+	return nil
+}
+
+// Run flushes every flush interval or when a batch is full, and a last time when the context is cancelled
+func (w *writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.mutex.Lock()
+			w.stopped = true
+			w.mutex.Unlock()
+
+			// the run context is cancelled already, so give the last flush its own deadline
+			flushCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			defer cancel()
+
+			err := w.Flush(flushCtx)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed flushing measurements to bigquery on shutdown")
+			}
+			return
+		case <-ticker.C:
+		case <-w.flushRequests:
+		}
+
+		err := w.Flush(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed flushing measurements to bigquery")
+		}
+	}
+}
+
+// Flush inserts the spooled and buffered measurements in batches; batches that keep failing go to the spool file
+func (w *writer) Flush(ctx context.Context) (err error) {
+	w.flushMutex.Lock()
+	defer w.flushMutex.Unlock()
+
+	w.mutex.Lock()
+	buffered := w.buffer
+	w.buffer = nil
+	w.mutex.Unlock()
+
+	spooled, skipped, readErr := w.readSpool()
+	if skipped > 0 {
+		log.Error().Msgf("Skipped %v unreadable lines in spool file %v", skipped, w.spoolPath)
+	}
+	if readErr != nil {
+		// keep the file for inspection instead of overwriting the measurements that couldn't be read
+		spooled = nil
+		movedPath, moveErr := w.moveSpoolAside()
+		if moveErr != nil {
+			return fmt.Errorf("Failed reading spool file %v and moving it aside: %v: %w", w.spoolPath, moveErr, readErr)
+		}
+		log.Error().Err(readErr).Msgf("Failed reading spool file %v, moved it to %v", w.spoolPath, movedPath)
+	}
+
+	measurements := append(spooled, buffered...)
+	if len(measurements) == 0 {
+		return nil
+	}
+
+	failed := []contractsv1.Measurement{}
+	for start := 0; start < len(measurements); start += w.batchSize {
+		end := start + w.batchSize
+		if end > len(measurements) {
+			end = len(measurements)
+		}
+		batch := measurements[start:end]
+
+		// stop trying once bigquery is unreachable and keep the remaining batches for the next flush
+		if err != nil {
+			failed = append(failed, batch...)
+			continue
+		}
+
+		err = w.insert(ctx, batch)
+		if err != nil && !isTransientError(err) {
+			log.Error().Err(err).Msgf("Dropping %v measurements bigquery refused to insert", len(batch))
+			err = nil
+			continue
+		}
+		if err != nil {
+			failed = append(failed, batch...)
+		}
+	}
+
+	if len(failed) > w.maxSpooled {
+		log.Error().Msgf("Dropping the %v oldest measurements to keep the spool at %v measurements", len(failed)-w.maxSpooled, w.maxSpooled)
+		failed = failed[len(failed)-w.maxSpooled:]
+	}
+
+	spoolErr := w.writeSpool(failed)
+	if spoolErr != nil {
+		log.Error().Err(spoolErr).Msgf("Failed spooling %v measurements to %v, they're lost", len(failed), w.spoolPath)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("Inserting %v measurements failed, spooled them for the next flush: %w", len(failed), err)
+	}
+
+	w.mutex.Lock()
+	w.lastFlushErr = err
+	w.mutex.Unlock()
+
+	return err
+}
+
+func (w *writer) insert(ctx context.Context, batch []contractsv1.Measurement) error {
+	return foundation.Retry(func() error {
+		return w.inserter.InsertMeasurements(ctx, w.dataset, w.table, batch)
+	},
+		foundation.Attempts(w.retryAttempts),
+		foundation.DelayMillisecond(w.retryDelayMillisecond),
+		foundation.LastErrorOnly(true),
+		func(config *foundation.RetryConfig) {
+			// foundation's exponential backoff counts in nanoseconds and its jitter isn't safe for concurrent use
+			config.DelayType = exponentialBackoffDelay
+			config.IsRetryableError = isTransientError
+		})
+}
+
+func exponentialBackoffDelay(n uint, config *foundation.RetryConfig) time.Duration {
+	return time.Duration(config.DelayMillisecond) * time.Millisecond * (1 << n)
+}
+
+// isTransientError returns false for errors that won't go away by retrying, like rows not matching the schema
+func isTransientError(err error) bool {
+	var putMultiError googlebigquery.PutMultiError
+	if errors.As(err, &putMultiError) {
+		return false
+	}
+
+	var apiError *googleapi.Error
+	if errors.As(err, &apiError) {
+		return apiError.Code >= 500 || apiError.Code == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+// readSpool returns the spooled measurements; lines that can't be decoded, like one cut off by a crash while appending,
+// are skipped and counted
+func (w *writer) readSpool() (measurements []contractsv1.Measurement, skipped int, err error) {
+	if w.spoolPath == "" {
+		return
+	}
+
+	f, err := os.Open(w.spoolPath)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		measurement := contractsv1.Measurement{}
+		if json.Unmarshal(scanner.Bytes(), &measurement) != nil {
+			skipped++
+			continue
+		}
+		measurements = append(measurements, measurement)
+	}
+
+	return measurements, skipped, scanner.Err()
+}
+
+// moveSpoolAside renames a spool file that can't be read, so the next flush starts a new one
+func (w *writer) moveSpoolAside() (movedPath string, err error) {
+	movedPath = fmt.Sprintf("%v.unreadable-%v", w.spoolPath, time.Now().UTC().Format("20060102T150405"))
+	return movedPath, os.Rename(w.spoolPath, movedPath)
+}
+
+// writeSpool replaces the spool file with measurements, or removes it when there are none
+func (w *writer) writeSpool(measurements []contractsv1.Measurement) (err error) {
+	if w.spoolPath == "" {
+		if len(measurements) > 0 {
+			return fmt.Errorf("No spool file configured")
+		}
+		return nil
+	}
+
+	if len(measurements) == 0 {
+		err = os.Remove(w.spoolPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// write to a temporary file first, so a crash never leaves a half written spool file
+	tempPath := w.spoolPath + ".tmp"
+	err = writeMeasurements(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, measurements)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tempPath, w.spoolPath)
+}
+
+// spoolAfterStop appends a measurement written after the last flush to the spool file, dropping the oldest spooled
+// measurements like Flush does once the spool holds max spooled measurements; an unreadable spool is left for the next
+// flush to move aside
+func (w *writer) spoolAfterStop(measurement contractsv1.Measurement) (err error) {
+	spooled, _, readErr := w.readSpool()
+	if readErr != nil || len(spooled) < w.maxSpooled {
+		return w.appendToSpool([]contractsv1.Measurement{measurement})
+	}
+
+	log.Error().Msgf("Dropping the %v oldest measurements to keep the spool at %v measurements", len(spooled)-w.maxSpooled+1, w.maxSpooled)
+	spooled = append(spooled[len(spooled)-w.maxSpooled+1:], measurement)
+
+	return w.writeSpool(spooled)
+}
+
+// appendToSpool adds measurements to the spool file in a single write; if an earlier append got cut off it starts on a
+// new line, so only the cut off line is lost
+func (w *writer) appendToSpool(measurements []contractsv1.Measurement) (err error) {
+	if w.spoolPath == "" {
+		return fmt.Errorf("No spool file configured")
+	}
+
+	data, err := encodeMeasurements(measurements)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(w.spoolPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		_, err = f.ReadAt(last, info.Size()-1)
+		if err != nil {
+			f.Close()
+			return
+		}
+		if last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	return f.Close()
+}
+
+func writeMeasurements(path string, flag int, measurements []contractsv1.Measurement) (err error) {
+	data, err := encodeMeasurements(measurements)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	return f.Close()
+}
+
+// encodeMeasurements returns the measurements as json lines
+func encodeMeasurements(measurements []contractsv1.Measurement) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, measurement := range measurements {
+		err := encoder.Encode(measurement)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,301 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	googlebigquery "cloud.google.com/go/bigquery"
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+type fakeInserter struct {
+	mutex    sync.Mutex
+	errors   []error
+	calls    int
+	inserted []contractsv1.Measurement
+}
+
+func (i *fakeInserter) InsertMeasurements(ctx context.Context, dataset, table string, measurements []contractsv1.Measurement) (err error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.calls++
+	if len(i.errors) > 0 {
+		err = i.errors[0]
+		i.errors = i.errors[1:]
+		if err != nil {
+			return err
+		}
+	}
+
+	i.inserted = append(i.inserted, measurements...)
+	return nil
+}
+
+func (i *fakeInserter) getInserted() []contractsv1.Measurement {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return append([]contractsv1.Measurement{}, i.inserted...)
+}
+
+func newTestWriter(t *testing.T, inserter Inserter, batchSize int) (*writer, string) {
+	spoolPath := filepath.Join(t.TempDir(), "spool.jsonl")
+	w, err := NewWriter(inserter, "jarvis", "measurements", batchSize, time.Hour, spoolPath, 100)
+	assert.Nil(t, err)
+
+	testWriter := w.(*writer)
+	testWriter.retryAttempts = 3
+	testWriter.retryDelayMillisecond = 1
+
+	return testWriter, spoolPath
+}
+
+func TestFlush(t *testing.T) {
+	t.Run("InsertsBufferedMeasurementsInBatches", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, _ := newTestWriter(t, inserter, 2)
+		for i := 0; i < 5; i++ {
+			w.Write(contractsv1.Measurement{ID: fmt.Sprint(i)})
+		}
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, inserter.calls)
+		assert.Equal(t, 5, len(inserter.getInserted()))
+	})
+
+	t.Run("RetriesTransientErrors", func(t *testing.T) {
+
+		inserter := &fakeInserter{errors: []error{&googleapi.Error{Code: 503}, fmt.Errorf("Connection reset")}}
+		w, _ := newTestWriter(t, inserter, 10)
+		w.Write(contractsv1.Measurement{ID: "a"})
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, inserter.calls)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}}, inserter.getInserted())
+	})
+
+	t.Run("DropsMeasurementsOnPermanentErrors", func(t *testing.T) {
+
+		inserter := &fakeInserter{errors: []error{googlebigquery.PutMultiError{{InsertID: "a"}}}}
+		w, spoolPath := newTestWriter(t, inserter, 10)
+		w.Write(contractsv1.Measurement{ID: "a"})
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, inserter.calls)
+		_, statErr := os.Stat(spoolPath)
+		assert.True(t, os.IsNotExist(statErr))
+	})
+
+	t.Run("SpoolsMeasurementsWhenBigqueryIsUnreachable", func(t *testing.T) {
+
+		unreachable := fmt.Errorf("Network is unreachable")
+		inserter := &fakeInserter{errors: []error{unreachable, unreachable, unreachable}}
+		w, spoolPath := newTestWriter(t, inserter, 10)
+		w.Write(contractsv1.Measurement{ID: "a"})
+		w.Write(contractsv1.Measurement{ID: "b"})
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(inserter.getInserted()))
+		spooled, _, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}, {ID: "b"}}, spooled)
+		assert.FileExists(t, spoolPath)
+
+		// the next write reports the failed flush
+		assert.NotNil(t, w.Write(contractsv1.Measurement{ID: "c"}))
+	})
+
+	t.Run("InsertsSpooledMeasurementsOnceBigqueryIsReachableAgain", func(t *testing.T) {
+
+		unreachable := fmt.Errorf("Network is unreachable")
+		inserter := &fakeInserter{errors: []error{unreachable, unreachable, unreachable}}
+		w, spoolPath := newTestWriter(t, inserter, 10)
+		w.Write(contractsv1.Measurement{ID: "a"})
+		w.Flush(context.Background())
+		w.Write(contractsv1.Measurement{ID: "b"})
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}, {ID: "b"}}, inserter.getInserted())
+		_, statErr := os.Stat(spoolPath)
+		assert.True(t, os.IsNotExist(statErr))
+		assert.Nil(t, w.Write(contractsv1.Measurement{ID: "c"}))
+	})
+
+	t.Run("SkipsTruncatedSpoolLinesAndKeepsTheRest", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, spoolPath := newTestWriter(t, inserter, 10)
+		err := ioutil.WriteFile(spoolPath, []byte("{\"id\":\"a\"}\n{\"id\":\"b\",\"loc\n{\"id\":\"c\"}\n"), 0644)
+		assert.Nil(t, err)
+		w.Write(contractsv1.Measurement{ID: "d"})
+
+		// act
+		err = w.Flush(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}, {ID: "c"}, {ID: "d"}}, inserter.getInserted())
+		_, statErr := os.Stat(spoolPath)
+		assert.True(t, os.IsNotExist(statErr))
+	})
+
+	t.Run("MovesUnreadableSpoolAsideInsteadOfOverwritingIt", func(t *testing.T) {
+
+		unreachable := fmt.Errorf("Network is unreachable")
+		inserter := &fakeInserter{errors: []error{unreachable, unreachable, unreachable}}
+		w, spoolPath := newTestWriter(t, inserter, 10)
+		// a line longer than the scanner buffer can't be read
+		err := ioutil.WriteFile(spoolPath, append(bytes.Repeat([]byte("x"), 17*1024*1024), '\n'), 0644)
+		assert.Nil(t, err)
+		w.Write(contractsv1.Measurement{ID: "a"})
+
+		// act
+		err = w.Flush(context.Background())
+
+		assert.NotNil(t, err)
+		movedPaths, _ := filepath.Glob(spoolPath + ".unreadable-*")
+		if assert.Equal(t, 1, len(movedPaths)) {
+			info, statErr := os.Stat(movedPaths[0])
+			assert.Nil(t, statErr)
+			assert.Equal(t, int64(17*1024*1024+1), info.Size())
+		}
+		spooled, _, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}}, spooled)
+	})
+
+	t.Run("DropsOldestMeasurementsBeyondMaxSpooled", func(t *testing.T) {
+
+		unreachable := fmt.Errorf("Network is unreachable")
+		inserter := &fakeInserter{errors: []error{unreachable, unreachable, unreachable}}
+		w, _ := newTestWriter(t, inserter, 10)
+		w.maxSpooled = 2
+		w.Write(contractsv1.Measurement{ID: "a"})
+		w.Write(contractsv1.Measurement{ID: "b"})
+		w.Write(contractsv1.Measurement{ID: "c"})
+
+		// act
+		err := w.Flush(context.Background())
+
+		assert.NotNil(t, err)
+		spooled, _, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "b"}, {ID: "c"}}, spooled)
+	})
+}
+
+func TestAppendToSpool(t *testing.T) {
+	t.Run("StartsOnNewLineAfterCutOffAppend", func(t *testing.T) {
+
+		w, spoolPath := newTestWriter(t, &fakeInserter{}, 10)
+		err := ioutil.WriteFile(spoolPath, []byte("{\"id\":\"a\"}\n{\"id\":\"b\",\"lo"), 0644)
+		assert.Nil(t, err)
+
+		// act
+		err = w.appendToSpool([]contractsv1.Measurement{{ID: "c"}})
+
+		assert.Nil(t, err)
+		spooled, skipped, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, 1, skipped)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}, {ID: "c"}}, spooled)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("FlushesWhenBatchIsFull", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, _ := newTestWriter(t, inserter, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go w.Run(ctx)
+
+		// act
+		w.Write(contractsv1.Measurement{ID: "a"})
+		w.Write(contractsv1.Measurement{ID: "b"})
+
+		assert.Eventually(t, func() bool { return len(inserter.getInserted()) == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("FlushesOnCancellation", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, _ := newTestWriter(t, inserter, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+		w.Write(contractsv1.Measurement{ID: "a"})
+
+		// act
+		cancel()
+		<-done
+
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}}, inserter.getInserted())
+	})
+
+	t.Run("SpoolsMeasurementsWrittenAfterCancellation", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, _ := newTestWriter(t, inserter, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w.Run(ctx)
+
+		// act
+		err := w.Write(contractsv1.Measurement{ID: "a"})
+
+		assert.Nil(t, err)
+		spooled, _, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "a"}}, spooled)
+	})
+
+	t.Run("DropsOldestSpooledMeasurementsBeyondMaxSpooledAfterCancellation", func(t *testing.T) {
+
+		inserter := &fakeInserter{}
+		w, _ := newTestWriter(t, inserter, 10)
+		w.maxSpooled = 2
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w.Run(ctx)
+		w.Write(contractsv1.Measurement{ID: "a"})
+		w.Write(contractsv1.Measurement{ID: "b"})
+
+		// act
+		err := w.Write(contractsv1.Measurement{ID: "c"})
+
+		assert.Nil(t, err)
+		spooled, _, readErr := w.readSpool()
+		assert.Nil(t, readErr)
+		assert.Equal(t, []contractsv1.Measurement{{ID: "b"}, {ID: "c"}}, spooled)
+	})
+}
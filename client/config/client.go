@@ -34,5 +34,10 @@ func (c *client) ReadConfigFromFile(path string) (config apiv1.Config, err error
 
 	config.SetDefaults()
 
+	err = config.Validate()
+	if err != nil {
+		return config, err
+	}
+
 	return
 }
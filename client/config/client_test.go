@@ -3,8 +3,10 @@ package config
 import (
 	"context"
 	"testing"
+	"time"
 
 	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,11 +22,37 @@ func TestReadConfigFromFile(t *testing.T) {
 
 		assert.Nil(t, err)
 		assert.Equal(t, "My Home", config.Location)
-		assert.Equal(t, 2, len(config.SampleConfigs))
+		assert.Equal(t, 3, len(config.SampleConfigs))
 		assert.Equal(t, contractsv1.EntityType_ENTITY_TYPE_ZONE, config.SampleConfigs[0].EntityType)
 		assert.Equal(t, "Uponor Smatrix T-169", config.SampleConfigs[0].EntityName)
 		assert.Equal(t, contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE, config.SampleConfigs[0].SampleType)
 		assert.Equal(t, "Bathroom", config.SampleConfigs[0].SampleName)
 		assert.Equal(t, contractsv1.MetricType_METRIC_TYPE_GAUGE, config.SampleConfigs[0].MetricType)
+		assert.Equal(t, apiv1.ValueTypeTemperature, config.SampleConfigs[0].ValueType)
+		assert.Equal(t, "Living room", config.SampleConfigs[1].SampleName)
+		assert.Equal(t, "efgh", config.SampleConfigs[1].ThermostatID)
+		assert.Equal(t, contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE_SETPOINT, config.SampleConfigs[2].SampleType)
+		assert.Equal(t, apiv1.ValueTypeSetpoint, config.SampleConfigs[2].ValueType)
+		assert.Equal(t, "01:145038", config.DeviceFilter.ControllerID)
+		assert.Equal(t, []string{"13:106039"}, config.DeviceFilter.Allowlist)
+		assert.False(t, config.DeviceFilter.Learn)
+		assert.Equal(t, 30*time.Minute, config.SampleConfigs[0].MaxAge)
+		assert.Equal(t, 30*time.Minute, config.SampleConfigs[1].MaxAge)
+		assert.Equal(t, 2*time.Hour, config.SampleConfigs[2].MaxAge)
+		assert.Equal(t, apiv1.AggregationLast, config.SampleConfigs[0].Aggregation)
+		assert.Equal(t, apiv1.AggregationTimeWeightedMean, config.SampleConfigs[2].Aggregation)
+	})
+
+	t.Run("ReturnsErrorForUnknownAggregation", func(t *testing.T) {
+
+		ctx := context.Background()
+		client, _ := NewClient(ctx)
+
+		// act
+		_, err := client.ReadConfigFromFile("./test-config-unknown-aggregation.yaml")
+
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), `unknown aggregation "avg"`)
+		}
 	})
 }
@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"gopkg.in/yaml.v2"
+)
+
+// DeviceSource lists the devices received by the antenna, like antenna.Client does
+type DeviceSource interface {
+	GetDevices() []antenna.Device
+}
+
+// Client is the interface for turning received devices into a starter config
+type Client interface {
+	GenerateConfig(location string) apiv1.Config
+	WriteConfig(w io.Writer, location string) (err error)
+}
+
+// NewClient returns new discovery.Client
+func NewClient(source DeviceSource) (Client, error) {
+	if source == nil {
+		return nil, fmt.Errorf("Please set the device source for discovery")
+	}
+
+	return &client{
+		source: source,
+	}, nil
+}
+
+type client struct {
+	source DeviceSource
+}
+
+// zonedDeviceTypes are the device types reporting values for multiple zones, which need the zone index in the
+// thermostat id
+var zonedDeviceTypes = map[string]bool{
+	"01": true,
+	"02": true,
+}
+
+// GenerateConfig returns a config with a sample for every decoded value of every zone of every device; value types
+// without a matching jarvis sample type, like heat demand or battery level, get the unspecified empty sample type, so
+// they're stored next to the others and can be told apart by their value type
+func (c *client) GenerateConfig(location string) apiv1.Config {
+	config := apiv1.Config{
+		Location:      location,
+		SampleConfigs: []apiv1.ConfigSample{},
+	}
+
+	for _, device := range c.source.GetDevices() {
+		for _, zoneIndex := range sortedZoneIndexes(device) {
+			for _, valueType := range device.ValueTypes[zoneIndex] {
+				config.SampleConfigs = append(config.SampleConfigs, apiv1.ConfigSample{
+					EntityType:      contractsv1.EntityType_ENTITY_TYPE_ZONE,
+					EntityName:      device.Address.DeviceTypeName(),
+					SampleType:      sampleTypeForValueType(valueType),
+					SampleName:      fmt.Sprintf("%v zone %02X", device.Address, zoneIndex),
+					MetricType:      contractsv1.MetricType_METRIC_TYPE_GAUGE,
+					ValueMultiplier: 1,
+					ThermostatID:    thermostatID(device, zoneIndex),
+					ValueType:       valueType,
+				})
+			}
+		}
+	}
+
+	return config
+}
+
+// WriteConfig writes the generated config as yaml, preceded by the device inventory as comments
+func (c *client) WriteConfig(w io.Writer, location string) (err error) {
+	devices := c.source.GetDevices()
+
+	_, err = fmt.Fprintf(w, "# discovered %v devices\n", len(devices))
+	if err != nil {
+		return
+	}
+	for _, device := range devices {
+		_, err = fmt.Fprintf(w, "# %v %v, rssi %03d, last seen %v, opcodes %v\n", device.Address, strings.ToLower(device.Address.DeviceTypeName()), device.RSSI.Last, device.LastSeen.Format(time.RFC3339), formatOpcodes(device.Opcodes))
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "# samples with an empty sampleType, like heatDemand or batteryLevel, have no matching jarvis sample type\n")
+	if err != nil {
+		return
+	}
+
+	data, err := yaml.Marshal(c.GenerateConfig(location))
+	if err != nil {
+		return fmt.Errorf("Failed marshalling generated config: %w", err)
+	}
+
+	_, err = w.Write(data)
+	return
+}
+
+// thermostatID includes the zone index for controllers, even when only a single zone got received from them so far
+func thermostatID(device antenna.Device, zoneIndex int) string {
+	if !zonedDeviceTypes[device.Address.DeviceType()] {
+		return string(device.Address)
+	}
+	return fmt.Sprintf("%v/%02X", device.Address, zoneIndex)
+}
+
+func sortedZoneIndexes(device antenna.Device) (zoneIndexes []int) {
+	for zoneIndex := range device.ValueTypes {
+		zoneIndexes = append(zoneIndexes, zoneIndex)
+	}
+	sort.Ints(zoneIndexes)
+
+	return
+}
+
+// sampleTypeForValueType returns the jarvis sample type of a value type, or the unspecified one if there's no match
+func sampleTypeForValueType(valueType apiv1.ValueType) contractsv1.SampleType {
+	switch valueType {
+	case apiv1.ValueTypeTemperature, apiv1.ValueTypeFloorTemperature:
+		return contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE
+	case apiv1.ValueTypeSetpoint, apiv1.ValueTypeOverrideSetpoint:
+		return contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE_SETPOINT
+	case apiv1.ValueTypeHumidity:
+		return contractsv1.SampleType_SAMPLE_TYPE_HUMIDITY
+	}
+
+	return contractsv1.SampleType_SAMPLE_TYPE_INVALID
+}
+
+// formatOpcodes prints opcodes with their frame counts like 2309(4) 30C9(12)
+func formatOpcodes(opcodes map[protocol.Opcode]uint64) string {
+	keys := []string{}
+	for opcode := range opcodes {
+		keys = append(keys, string(opcode))
+	}
+	sort.Strings(keys)
+
+	formatted := []string{}
+	for _, opcode := range keys {
+		formatted = append(formatted, fmt.Sprintf("%v(%v)", opcode, opcodes[protocol.Opcode(opcode)]))
+	}
+
+	return strings.Join(formatted, " ")
+}
@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+type fakeDeviceSource struct {
+	devices []antenna.Device
+}
+
+func (s *fakeDeviceSource) GetDevices() []antenna.Device {
+	return s.devices
+}
+
+func newTestDeviceSource() *fakeDeviceSource {
+	lastSeen := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+	return &fakeDeviceSource{
+		devices: []antenna.Device{
+			{
+				Address:    "01:145038",
+				LastSeen:   lastSeen,
+				RSSI:       antenna.RSSIStatistics{Last: 62},
+				Opcodes:    map[protocol.Opcode]uint64{"30C9": 12, "2309": 4},
+				ValueTypes: map[int][]apiv1.ValueType{1: {apiv1.ValueTypeTemperature}, 0: {apiv1.ValueTypeSetpoint, apiv1.ValueTypeTemperature}},
+			},
+			{
+				Address:    "13:106039",
+				LastSeen:   lastSeen,
+				RSSI:       antenna.RSSIStatistics{Last: 70},
+				Opcodes:    map[protocol.Opcode]uint64{"1FC9": 1},
+				ValueTypes: map[int][]apiv1.ValueType{},
+			},
+			{
+				Address:    "34:092243",
+				LastSeen:   lastSeen,
+				RSSI:       antenna.RSSIStatistics{Last: 45},
+				Opcodes:    map[protocol.Opcode]uint64{"30C9": 3},
+				ValueTypes: map[int][]apiv1.ValueType{0: {apiv1.ValueTypeTemperature}},
+			},
+		},
+	}
+}
+
+func TestGenerateConfig(t *testing.T) {
+	t.Run("ReturnsSamplePerZoneAndValueTypeOfEveryDevice", func(t *testing.T) {
+
+		client, err := NewClient(newTestDeviceSource())
+		assert.Nil(t, err)
+
+		// act
+		config := client.GenerateConfig("My Home")
+
+		assert.Equal(t, "My Home", config.Location)
+		if assert.Equal(t, 4, len(config.SampleConfigs)) {
+			assert.Equal(t, apiv1.ConfigSample{
+				EntityType:      contractsv1.EntityType_ENTITY_TYPE_ZONE,
+				EntityName:      "Controller",
+				SampleType:      contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE_SETPOINT,
+				SampleName:      "01:145038 zone 00",
+				MetricType:      contractsv1.MetricType_METRIC_TYPE_GAUGE,
+				ValueMultiplier: 1,
+				ThermostatID:    "01:145038/00",
+				ValueType:       apiv1.ValueTypeSetpoint,
+			}, config.SampleConfigs[0])
+			assert.Equal(t, "01:145038/00", config.SampleConfigs[1].ThermostatID)
+			assert.Equal(t, apiv1.ValueTypeTemperature, config.SampleConfigs[1].ValueType)
+			assert.Equal(t, "01:145038/01", config.SampleConfigs[2].ThermostatID)
+			assert.Equal(t, "34:092243", config.SampleConfigs[3].ThermostatID)
+			assert.Equal(t, "Thermostat", config.SampleConfigs[3].EntityName)
+		}
+	})
+
+	t.Run("IncludesValueTypesWithoutSampleTypeWithEmptySampleType", func(t *testing.T) {
+
+		client, err := NewClient(&fakeDeviceSource{devices: []antenna.Device{
+			{
+				Address:    "04:056057",
+				ValueTypes: map[int][]apiv1.ValueType{0: {apiv1.ValueTypeTemperature, apiv1.ValueTypeHeatDemand, apiv1.ValueTypeBatteryLevel, apiv1.ValueTypeWindowOpen}},
+			},
+			{
+				Address:    "13:106039",
+				ValueTypes: map[int][]apiv1.ValueType{0: {apiv1.ValueTypeRelayDemand, apiv1.ValueTypeActuatorState}},
+			},
+		}})
+		assert.Nil(t, err)
+
+		// act
+		config := client.GenerateConfig("My Home")
+
+		if assert.Equal(t, 6, len(config.SampleConfigs)) {
+			assert.Equal(t, apiv1.ValueTypeTemperature, config.SampleConfigs[0].ValueType)
+			assert.Equal(t, contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE, config.SampleConfigs[0].SampleType)
+			for i, valueType := range []apiv1.ValueType{apiv1.ValueTypeHeatDemand, apiv1.ValueTypeBatteryLevel, apiv1.ValueTypeWindowOpen, apiv1.ValueTypeRelayDemand, apiv1.ValueTypeActuatorState} {
+				assert.Equal(t, valueType, config.SampleConfigs[i+1].ValueType)
+				assert.Equal(t, contractsv1.SampleType_SAMPLE_TYPE_INVALID, config.SampleConfigs[i+1].SampleType)
+			}
+			assert.Equal(t, "13:106039", config.SampleConfigs[4].ThermostatID)
+		}
+	})
+
+	t.Run("IncludesZoneIndexForControllerWithSingleZone", func(t *testing.T) {
+
+		client, err := NewClient(&fakeDeviceSource{devices: []antenna.Device{
+			{
+				Address:    "01:145038",
+				ValueTypes: map[int][]apiv1.ValueType{2: {apiv1.ValueTypeTemperature}},
+			},
+		}})
+		assert.Nil(t, err)
+
+		// act
+		config := client.GenerateConfig("My Home")
+
+		if assert.Equal(t, 1, len(config.SampleConfigs)) {
+			assert.Equal(t, "01:145038/02", config.SampleConfigs[0].ThermostatID)
+		}
+	})
+}
+
+func TestWriteConfig(t *testing.T) {
+	t.Run("WritesInventoryCommentsAndValidConfigYaml", func(t *testing.T) {
+
+		client, err := NewClient(newTestDeviceSource())
+		assert.Nil(t, err)
+		var buffer bytes.Buffer
+
+		// act
+		err = client.WriteConfig(&buffer, "My Home")
+
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(buffer.String(), "# discovered 3 devices\n# 01:145038 controller, rssi 062, last seen 2020-10-11T22:30:00Z, opcodes 2309(4) 30C9(12)\n"))
+		assert.Contains(t, buffer.String(), "# 13:106039 relay, rssi 070")
+		assert.Contains(t, buffer.String(), "# samples with an empty sampleType")
+
+		config := apiv1.Config{}
+		err = yaml.UnmarshalStrict(buffer.Bytes(), &config)
+		assert.Nil(t, err)
+		assert.Equal(t, client.GenerateConfig("My Home"), config)
+	})
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+)
+
+// AntennaSource provides the connection statistics of the antenna, like antenna.Client does
+type AntennaSource interface {
+	GetStatistics() antenna.Statistics
+}
+
+// SinkSource provides when measurements got stored for the last time, like scheduler.Client does
+type SinkSource interface {
+	LastSuccessfulStore() time.Time
+}
+
+// Client is the interface for the /healthz and /readyz endpoints
+type Client interface {
+	LivenessHandler() http.Handler
+	ReadinessHandler() http.Handler
+}
+
+// Check is the result of a single health check as returned in the response body
+type Check struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+// NewClient returns new health.Client; the antenna is considered stuck when no valid frame got received for
+// maxFrameAge and sinks are considered failing when nothing got stored for maxStoreAge
+func NewClient(antennaSource AntennaSource, sinkSource SinkSource, maxFrameAge, maxStoreAge time.Duration) (Client, error) {
+	if antennaSource == nil {
+		return nil, fmt.Errorf("Please set the antenna source for health checks")
+	}
+	if maxFrameAge <= 0 || maxStoreAge <= 0 {
+		return nil, fmt.Errorf("Please set a maximum frame and store age larger than 0")
+	}
+
+	return &client{
+		antennaSource: antennaSource,
+		sinkSource:    sinkSource,
+		maxFrameAge:   maxFrameAge,
+		maxStoreAge:   maxStoreAge,
+		startTime:     time.Now().UTC(),
+		now:           func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+type client struct {
+	antennaSource AntennaSource
+	sinkSource    SinkSource
+	maxFrameAge   time.Duration
+	maxStoreAge   time.Duration
+	startTime     time.Time
+	now           func() time.Time
+}
+
+// LivenessHandler fails when no valid frame got received for too long, so kubernetes restarts the pod if the antenna
+// is wedged
+func (c *client) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChecks(w, []Check{c.checkLastValidFrame()})
+	})
+}
+
+// ReadinessHandler fails when the antenna is disconnected, no valid frame got received or measurements can't be stored;
+// there is no check for the config, because the exporter exits when it can't load it
+func (c *client) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChecks(w, []Check{
+			c.checkConnected(),
+			c.checkLastValidFrame(),
+			c.checkLastSuccessfulStore(),
+		})
+	})
+}
+
+func (c *client) checkConnected() Check {
+	if !c.antennaSource.GetStatistics().Connected {
+		return Check{Name: "antenna", Healthy: false, Message: "Antenna is disconnected"}
+	}
+	return Check{Name: "antenna", Healthy: true, Message: "Antenna is connected"}
+}
+
+func (c *client) checkLastValidFrame() Check {
+	lastValidFrame := c.antennaSource.GetStatistics().LastValidFrame
+	return c.checkAge("frames", "valid frame received", lastValidFrame, c.maxFrameAge)
+}
+
+func (c *client) checkLastSuccessfulStore() Check {
+	if c.sinkSource == nil {
+		return Check{Name: "sinks", Healthy: true, Message: "No sinks configured"}
+	}
+	return c.checkAge("sinks", "measurement stored", c.sinkSource.LastSuccessfulStore(), c.maxStoreAge)
+}
+
+// checkAge fails if the last event happened longer than maxAge ago; before the first event the age counts from startup
+func (c *client) checkAge(name, event string, last time.Time, maxAge time.Duration) Check {
+	if last.IsZero() {
+		if age := c.now().Sub(c.startTime); age > maxAge {
+			return Check{Name: name, Healthy: false, Message: fmt.Sprintf("No %v since startup %v ago", event, age.Round(time.Second))}
+		}
+		return Check{Name: name, Healthy: true, Message: fmt.Sprintf("No %v yet", event)}
+	}
+
+	age := c.now().Sub(last)
+	if age > maxAge {
+		return Check{Name: name, Healthy: false, Message: fmt.Sprintf("Last %v %v ago, more than %v", event, age.Round(time.Second), maxAge)}
+	}
+	return Check{Name: name, Healthy: true, Message: fmt.Sprintf("Last %v %v ago", event, age.Round(time.Second))}
+}
+
+func writeChecks(w http.ResponseWriter, checks []Check) {
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(checks)
+}
@@ -0,0 +1,116 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAntennaSource struct {
+	statistics antenna.Statistics
+}
+
+func (s *fakeAntennaSource) GetStatistics() antenna.Statistics {
+	return s.statistics
+}
+
+type fakeSinkSource struct {
+	lastSuccessfulStore time.Time
+}
+
+func (s *fakeSinkSource) LastSuccessfulStore() time.Time {
+	return s.lastSuccessfulStore
+}
+
+func TestLivenessHandler(t *testing.T) {
+	t.Run("ReturnsOkWhenValidFrameWasReceivedRecently", func(t *testing.T) {
+
+		antennaSource := &fakeAntennaSource{statistics: antenna.Statistics{LastValidFrame: time.Now().UTC().Add(-time.Minute)}}
+		client, err := NewClient(antennaSource, &fakeSinkSource{}, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+
+		assert.Equal(t, 200, recorder.Code)
+	})
+
+	t.Run("ReturnsServiceUnavailableWhenAntennaIsWedged", func(t *testing.T) {
+
+		antennaSource := &fakeAntennaSource{statistics: antenna.Statistics{Connected: true, LastValidFrame: time.Now().UTC().Add(-time.Hour)}}
+		client, err := NewClient(antennaSource, &fakeSinkSource{}, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+
+		assert.Equal(t, 503, recorder.Code)
+		checks := []Check{}
+		json.NewDecoder(recorder.Body).Decode(&checks)
+		if assert.Equal(t, 1, len(checks)) {
+			assert.Equal(t, "frames", checks[0].Name)
+			assert.False(t, checks[0].Healthy)
+		}
+	})
+
+	t.Run("ReturnsOkBeforeFirstFrameWithinMaximumAge", func(t *testing.T) {
+
+		client, err := NewClient(&fakeAntennaSource{}, &fakeSinkSource{}, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+
+		assert.Equal(t, 200, recorder.Code)
+	})
+}
+
+func TestReadinessHandler(t *testing.T) {
+	t.Run("ReturnsOkWhenAllChecksPass", func(t *testing.T) {
+
+		antennaSource := &fakeAntennaSource{statistics: antenna.Statistics{Connected: true, LastValidFrame: time.Now().UTC()}}
+		sinkSource := &fakeSinkSource{lastSuccessfulStore: time.Now().UTC().Add(-5 * time.Minute)}
+		client, err := NewClient(antennaSource, sinkSource, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, 200, recorder.Code)
+	})
+
+	t.Run("ReturnsServiceUnavailableWhenAntennaIsDisconnected", func(t *testing.T) {
+
+		antennaSource := &fakeAntennaSource{statistics: antenna.Statistics{Connected: false, LastValidFrame: time.Now().UTC()}}
+		client, err := NewClient(antennaSource, &fakeSinkSource{}, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, 503, recorder.Code)
+	})
+
+	t.Run("ReturnsServiceUnavailableWhenSinksFailForTooLong", func(t *testing.T) {
+
+		antennaSource := &fakeAntennaSource{statistics: antenna.Statistics{Connected: true, LastValidFrame: time.Now().UTC()}}
+		sinkSource := &fakeSinkSource{lastSuccessfulStore: time.Now().UTC().Add(-time.Hour)}
+		client, err := NewClient(antennaSource, sinkSource, 10*time.Minute, 30*time.Minute)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+		assert.Equal(t, 503, recorder.Code)
+	})
+}
@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jarvis_uponor_smatrix"
+
+// Source provides the live values and statistics to export, like antenna.Client does
+type Source interface {
+	GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error)
+	GetStatistics() antenna.Statistics
+	GetDevices() []antenna.Device
+}
+
+// Client is the interface for exposing live zone state as prometheus metrics
+type Client interface {
+	Handler() http.Handler
+}
+
+// NewClient returns new metrics.Client
+func NewClient(source Source, config apiv1.Config) (Client, error) {
+	if source == nil {
+		return nil, fmt.Errorf("Please set the source for metrics")
+	}
+
+	registry := prometheus.NewRegistry()
+	err := registry.Register(newCollector(source, config))
+	if err != nil {
+		return nil, err
+	}
+	err = registry.Register(prometheus.NewGoCollector())
+	if err != nil {
+		return nil, err
+	}
+	err = registry.Register(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		registry: registry,
+	}, nil
+}
+
+type client struct {
+	registry *prometheus.Registry
+}
+
+func (c *client) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{
+		// a broken sample config should not hide all other metrics
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// collector reads the latest values on every scrape, so metrics are never older than the received frames
+type collector struct {
+	source Source
+	config apiv1.Config
+	now    func() time.Time
+
+	sampleValue                     *prometheus.Desc
+	sampleStale                     *prometheus.Desc
+	staleSamples                    *prometheus.Desc
+	antennaConnected                *prometheus.Desc
+	framesReceived                  *prometheus.Desc
+	parseFailures                   *prometheus.Desc
+	foreignFrames                   *prometheus.Desc
+	connectionResets                *prometheus.Desc
+	secondsSinceLastReceivedMessage *prometheus.Desc
+
+	deviceRSSI                 *prometheus.Desc
+	deviceFrames               *prometheus.Desc
+	deviceMissedBroadcasts     *prometheus.Desc
+	deviceMaxBroadcastInterval *prometheus.Desc
+	deviceSecondsSinceLastSeen *prometheus.Desc
+}
+
+func newCollector(source Source, config apiv1.Config) *collector {
+	return &collector{
+		source: source,
+		config: config,
+		now:    time.Now,
+
+		sampleValue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sample_value"),
+			"Latest value for each configured sample.",
+			[]string{"location", "entity_name", "sample_name", "sample_type", "thermostat_id", "value_type"}, nil,
+		),
+		sampleStale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sample_stale"),
+			"Whether the reading of a configured sample is older than its max age; its value is omitted when it is.",
+			[]string{"location", "entity_name", "sample_name", "sample_type", "thermostat_id", "value_type"}, nil,
+		),
+		staleSamples: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stale_samples_total"),
+			"Number of samples omitted from measurements because their reading was older than the max age.",
+			nil, nil,
+		),
+		antennaConnected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "antenna_connected"),
+			"Whether the connection to the antenna is open.",
+			nil, nil,
+		),
+		framesReceived: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "frames_received_total"),
+			"Number of valid frames received per opcode.",
+			[]string{"opcode"}, nil,
+		),
+		parseFailures: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "parse_failures_total"),
+			"Number of received lines that could not be parsed into a frame.",
+			nil, nil,
+		),
+		foreignFrames: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "foreign_frames_total"),
+			"Number of frames dropped because they came from devices of another heating system.",
+			nil, nil,
+		),
+		connectionResets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "connection_resets_total"),
+			"Number of times the antenna connection got reset after an error or silence.",
+			nil, nil,
+		),
+		secondsSinceLastReceivedMessage: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "seconds_since_last_received_message"),
+			"Seconds since the last line got received from the antenna.",
+			nil, nil,
+		),
+
+		deviceRSSI: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "rssi"),
+			"Signal strength of the frames received from a device, as last, min, max and moving average.",
+			[]string{"address", "device_type", "statistic"}, nil,
+		),
+		deviceFrames: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "frames_received_total"),
+			"Number of frames received from a device.",
+			[]string{"address", "device_type"}, nil,
+		),
+		deviceMissedBroadcasts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "missed_broadcasts_total"),
+			"Estimated number of broadcasts from a device that didn't arrive.",
+			[]string{"address", "device_type"}, nil,
+		),
+		deviceMaxBroadcastInterval: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "max_broadcast_interval_seconds"),
+			"Longest time between two broadcasts of the same opcode by a device.",
+			[]string{"address", "device_type"}, nil,
+		),
+		deviceSecondsSinceLastSeen: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "seconds_since_last_seen"),
+			"Seconds since the last frame got received from a device.",
+			[]string{"address", "device_type"}, nil,
+		),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sampleValue
+	ch <- c.sampleStale
+	ch <- c.staleSamples
+	ch <- c.antennaConnected
+	ch <- c.framesReceived
+	ch <- c.parseFailures
+	ch <- c.foreignFrames
+	ch <- c.connectionResets
+	ch <- c.secondsSinceLastReceivedMessage
+	ch <- c.deviceRSSI
+	ch <- c.deviceFrames
+	ch <- c.deviceMissedBroadcasts
+	ch <- c.deviceMaxBroadcastInterval
+	ch <- c.deviceSecondsSinceLastSeen
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, sc := range c.config.SampleConfigs {
+		labels := []string{c.config.Location, sc.EntityName, sc.SampleName, string(sc.SampleType), sc.ThermostatID, string(sc.ValueType)}
+		sample, err := c.source.GetSample(c.config, sc)
+		if errors.Is(err, antenna.ErrStaleReading) {
+			ch <- prometheus.MustNewConstMetric(c.sampleStale, prometheus.GaugeValue, 1, labels...)
+			continue
+		}
+		if err != nil {
+			// no value received yet
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.sampleValue, prometheus.GaugeValue, sample.Value, labels...)
+		ch <- prometheus.MustNewConstMetric(c.sampleStale, prometheus.GaugeValue, 0, labels...)
+	}
+
+	statistics := c.source.GetStatistics()
+
+	connected := 0.0
+	if statistics.Connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.antennaConnected, prometheus.GaugeValue, connected)
+
+	for opcode, count := range statistics.FramesReceived {
+		ch <- prometheus.MustNewConstMetric(c.framesReceived, prometheus.CounterValue, float64(count), string(opcode))
+	}
+	ch <- prometheus.MustNewConstMetric(c.parseFailures, prometheus.CounterValue, float64(statistics.ParseFailures))
+	ch <- prometheus.MustNewConstMetric(c.foreignFrames, prometheus.CounterValue, float64(statistics.ForeignFrames))
+	ch <- prometheus.MustNewConstMetric(c.connectionResets, prometheus.CounterValue, float64(statistics.ConnectionResets))
+	ch <- prometheus.MustNewConstMetric(c.staleSamples, prometheus.CounterValue, float64(statistics.StaleSamples))
+
+	if !statistics.LastReceivedMessage.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.secondsSinceLastReceivedMessage, prometheus.GaugeValue, c.now().Sub(statistics.LastReceivedMessage).Seconds())
+	}
+
+	for _, device := range c.source.GetDevices() {
+		address, deviceType := string(device.Address), device.Address.DeviceTypeName()
+		ch <- prometheus.MustNewConstMetric(c.deviceRSSI, prometheus.GaugeValue, float64(device.RSSI.Last), address, deviceType, "last")
+		ch <- prometheus.MustNewConstMetric(c.deviceRSSI, prometheus.GaugeValue, float64(device.RSSI.Min), address, deviceType, "min")
+		ch <- prometheus.MustNewConstMetric(c.deviceRSSI, prometheus.GaugeValue, float64(device.RSSI.Max), address, deviceType, "max")
+		ch <- prometheus.MustNewConstMetric(c.deviceRSSI, prometheus.GaugeValue, device.RSSI.Average, address, deviceType, "average")
+		ch <- prometheus.MustNewConstMetric(c.deviceFrames, prometheus.CounterValue, float64(device.Frames), address, deviceType)
+		ch <- prometheus.MustNewConstMetric(c.deviceMissedBroadcasts, prometheus.CounterValue, float64(device.MissedBroadcasts), address, deviceType)
+		ch <- prometheus.MustNewConstMetric(c.deviceMaxBroadcastInterval, prometheus.GaugeValue, device.MaxBroadcastInterval.Seconds(), address, deviceType)
+		ch <- prometheus.MustNewConstMetric(c.deviceSecondsSinceLastSeen, prometheus.GaugeValue, c.now().Sub(device.LastSeen).Seconds(), address, deviceType)
+	}
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	values     map[string]float64
+	stale      map[string]bool
+	statistics antenna.Statistics
+	devices    []antenna.Device
+}
+
+func (s *fakeSource) GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error) {
+	if s.stale[sampleConfig.ThermostatID+string(sampleConfig.ValueType)] {
+		return sample, fmt.Errorf("Old reading: %w", antenna.ErrStaleReading)
+	}
+	value, ok := s.values[sampleConfig.ThermostatID+string(sampleConfig.ValueType)]
+	if !ok {
+		return sample, fmt.Errorf("No reading")
+	}
+	return contractsv1.Sample{SampleName: sampleConfig.SampleName, Value: value}, nil
+}
+
+func (s *fakeSource) GetStatistics() antenna.Statistics {
+	return s.statistics
+}
+
+func (s *fakeSource) GetDevices() []antenna.Device {
+	return s.devices
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("ExportsSamplesAndStatistics", func(t *testing.T) {
+
+		source := &fakeSource{
+			values: map[string]float64{
+				"34:092243temperature": 20.5,
+				"34:092243setpoint":    21,
+				"34:222222temperature": 18,
+			},
+			stale: map[string]bool{
+				"34:222222temperature": true,
+			},
+			statistics: antenna.Statistics{
+				Connected:           true,
+				LastReceivedMessage: time.Now().Add(-time.Minute),
+				FramesReceived:      map[protocol.Opcode]uint64{"30C9": 12},
+				ParseFailures:       3,
+				ForeignFrames:       7,
+				ConnectionResets:    1,
+				StaleSamples:        4,
+			},
+		}
+		config := apiv1.Config{
+			Location: "My Home",
+			SampleConfigs: []apiv1.ConfigSample{
+				{EntityName: "Uponor Smatrix T-169", SampleType: "SAMPLE_TYPE_TEMPERATURE", SampleName: "Living room", ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature},
+				{EntityName: "Uponor Smatrix T-169", SampleType: "SAMPLE_TYPE_TEMPERATURE_SETPOINT", SampleName: "Living room", ThermostatID: "34:092243", ValueType: apiv1.ValueTypeSetpoint},
+				{EntityName: "Uponor Smatrix T-169", SampleType: "SAMPLE_TYPE_TEMPERATURE", SampleName: "Bathroom", ThermostatID: "34:111111", ValueType: apiv1.ValueTypeTemperature},
+				{EntityName: "Uponor Smatrix T-169", SampleType: "SAMPLE_TYPE_TEMPERATURE", SampleName: "Bedroom", ThermostatID: "34:222222", ValueType: apiv1.ValueTypeTemperature},
+			},
+		}
+		client, err := NewClient(source, config)
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		body, _ := ioutil.ReadAll(recorder.Body)
+		metrics := string(body)
+		assert.Equal(t, 200, recorder.Code)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_sample_value{entity_name="Uponor Smatrix T-169",location="My Home",sample_name="Living room",sample_type="SAMPLE_TYPE_TEMPERATURE",thermostat_id="34:092243",value_type="temperature"} 20.5`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_sample_value{entity_name="Uponor Smatrix T-169",location="My Home",sample_name="Living room",sample_type="SAMPLE_TYPE_TEMPERATURE_SETPOINT",thermostat_id="34:092243",value_type="setpoint"} 21`)
+		assert.NotContains(t, metrics, `sample_name="Bathroom"`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_sample_stale{entity_name="Uponor Smatrix T-169",location="My Home",sample_name="Living room",sample_type="SAMPLE_TYPE_TEMPERATURE",thermostat_id="34:092243",value_type="temperature"} 0`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_sample_stale{entity_name="Uponor Smatrix T-169",location="My Home",sample_name="Bedroom",sample_type="SAMPLE_TYPE_TEMPERATURE",thermostat_id="34:222222",value_type="temperature"} 1`)
+		assert.NotContains(t, metrics, `jarvis_uponor_smatrix_sample_value{entity_name="Uponor Smatrix T-169",location="My Home",sample_name="Bedroom"`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_stale_samples_total 4`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_antenna_connected 1`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_frames_received_total{opcode="30C9"} 12`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_parse_failures_total 3`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_foreign_frames_total 7`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_connection_resets_total 1`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_seconds_since_last_received_message 60`)
+	})
+
+	t.Run("ExportsLinkQualityPerDevice", func(t *testing.T) {
+
+		source := &fakeSource{
+			devices: []antenna.Device{
+				{
+					Address:              "34:092243",
+					LastSeen:             time.Now().Add(-2 * time.Minute),
+					Frames:               40,
+					RSSI:                 antenna.RSSIStatistics{Last: 45, Min: 40, Max: 52, Average: 46.5},
+					MaxBroadcastInterval: 30 * time.Minute,
+					MissedBroadcasts:     2,
+				},
+			},
+		}
+		client, err := NewClient(source, apiv1.Config{})
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+
+		// act
+		client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		body, _ := ioutil.ReadAll(recorder.Body)
+		metrics := string(body)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_rssi{address="34:092243",device_type="Thermostat",statistic="last"} 45`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_rssi{address="34:092243",device_type="Thermostat",statistic="min"} 40`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_rssi{address="34:092243",device_type="Thermostat",statistic="max"} 52`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_rssi{address="34:092243",device_type="Thermostat",statistic="average"} 46.5`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_frames_received_total{address="34:092243",device_type="Thermostat"} 40`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_missed_broadcasts_total{address="34:092243",device_type="Thermostat"} 2`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_max_broadcast_interval_seconds{address="34:092243",device_type="Thermostat"} 1800`)
+		assert.Contains(t, metrics, `jarvis_uponor_smatrix_device_seconds_since_last_seen{address="34:092243",device_type="Thermostat"} 120`)
+	})
+}
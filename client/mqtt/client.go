@@ -0,0 +1,238 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+)
+
+// Client is the interface for publishing zone values to mqtt
+type Client interface {
+	PublishDiscovery() error
+	PublishMeasurement(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error
+	Close() error
+}
+
+// NewClient returns new mqtt.Client; values get published to <topicPrefix>/<location>/<zone>/<value type> and home
+// assistant discovery payloads to <discoveryPrefix>/<component>/<object id>/config
+func NewClient(publisher Publisher, config apiv1.Config, topicPrefix, discoveryPrefix string) (Client, error) {
+	if publisher == nil {
+		return nil, fmt.Errorf("Please set the publisher for mqtt")
+	}
+
+	return &client{
+		publisher:       publisher,
+		config:          config,
+		topicPrefix:     strings.TrimSuffix(topicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(discoveryPrefix, "/"),
+	}, nil
+}
+
+type client struct {
+	publisher       Publisher
+	config          apiv1.Config
+	topicPrefix     string
+	discoveryPrefix string
+}
+
+// AvailabilityTopic returns the topic holding online or offline for the exporter at location
+func AvailabilityTopic(topicPrefix, location string) string {
+	return fmt.Sprintf("%v/%v/status", strings.TrimSuffix(topicPrefix, "/"), slug(location))
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+type sensorDiscovery struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type climateDiscovery struct {
+	Name                    string          `json:"name"`
+	UniqueID                string          `json:"unique_id"`
+	CurrentTemperatureTopic string          `json:"current_temperature_topic"`
+	TemperatureStateTopic   string          `json:"temperature_state_topic"`
+	TemperatureUnit         string          `json:"temperature_unit"`
+	Modes                   []string        `json:"modes"`
+	AvailabilityTopic       string          `json:"availability_topic"`
+	Device                  discoveryDevice `json:"device"`
+}
+
+// PublishDiscovery announces a sensor for every configured sample and a climate entity for every zone with both a
+// temperature and a setpoint sample
+func (c *client) PublishDiscovery() error {
+	for _, sampleConfig := range c.config.SampleConfigs {
+		unit, deviceClass := unitForValueType(sampleConfig.ValueType)
+		payload := sensorDiscovery{
+			Name:              fmt.Sprintf("%v %v", sampleConfig.SampleName, strings.Replace(slug(string(sampleConfig.ValueType)), "_", " ", -1)),
+			UniqueID:          c.objectID(sampleConfig, string(sampleConfig.ValueType)),
+			StateTopic:        c.stateTopic(sampleConfig),
+			AvailabilityTopic: AvailabilityTopic(c.topicPrefix, c.config.Location),
+			DeviceClass:       deviceClass,
+			StateClass:        "measurement",
+			UnitOfMeasurement: unit,
+			Device:            c.device(sampleConfig),
+		}
+
+		err := c.publishJSON(c.discoveryTopic("sensor", payload.UniqueID), payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, zone := range c.climateZones() {
+		payload := climateDiscovery{
+			Name:                    zone.temperature.SampleName,
+			UniqueID:                c.objectID(zone.temperature, "climate"),
+			CurrentTemperatureTopic: c.stateTopic(zone.temperature),
+			TemperatureStateTopic:   c.stateTopic(zone.setpoint),
+			TemperatureUnit:         "C",
+			Modes:                   []string{"heat"},
+			AvailabilityTopic:       AvailabilityTopic(c.topicPrefix, c.config.Location),
+			Device:                  c.device(zone.temperature),
+		}
+
+		err := c.publishJSON(c.discoveryTopic("climate", payload.UniqueID), payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PublishMeasurement publishes every sample as a retained value to the topic of the config it got read for, so
+// subscribers get the latest value right away
+func (c *client) PublishMeasurement(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+	if len(sampleConfigs) != len(measurement.Samples) {
+		return fmt.Errorf("Got %v sample configs for %v samples", len(sampleConfigs), len(measurement.Samples))
+	}
+
+	failures := 0
+	var lastErr error
+	for i, sample := range measurement.Samples {
+		payload := strconv.FormatFloat(sample.Value, 'f', -1, 64)
+		err := c.publisher.Publish(c.stateTopic(sampleConfigs[i]), true, []byte(payload))
+		if err != nil {
+			failures++
+			lastErr = err
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("Publishing %v samples to mqtt failed: %w", failures, lastErr)
+	}
+
+	return nil
+}
+
+func (c *client) Close() error {
+	return c.publisher.Close()
+}
+
+func (c *client) stateTopic(sampleConfig apiv1.ConfigSample) string {
+	return fmt.Sprintf("%v/%v/%v/%v", c.topicPrefix, slug(c.config.Location), slug(sampleConfig.SampleName), slug(string(sampleConfig.ValueType)))
+}
+
+func (c *client) discoveryTopic(component, objectID string) string {
+	return fmt.Sprintf("%v/%v/%v/config", c.discoveryPrefix, component, objectID)
+}
+
+func (c *client) objectID(sampleConfig apiv1.ConfigSample, suffix string) string {
+	return fmt.Sprintf("uponor_%v_%v_%v", slug(c.config.Location), slug(sampleConfig.SampleName), slug(suffix))
+}
+
+func (c *client) device(sampleConfig apiv1.ConfigSample) discoveryDevice {
+	return discoveryDevice{
+		Identifiers:  []string{fmt.Sprintf("uponor_%v_%v", slug(c.config.Location), slug(sampleConfig.SampleName))},
+		Name:         sampleConfig.SampleName,
+		Manufacturer: "Uponor",
+		Model:        sampleConfig.EntityName,
+	}
+}
+
+type climateZone struct {
+	temperature apiv1.ConfigSample
+	setpoint    apiv1.ConfigSample
+}
+
+func (c *client) climateZones() (zones []climateZone) {
+	for _, temperature := range c.config.SampleConfigs {
+		if temperature.ValueType != apiv1.ValueTypeTemperature {
+			continue
+		}
+		for _, setpoint := range c.config.SampleConfigs {
+			if setpoint.SampleName == temperature.SampleName && setpoint.ValueType == apiv1.ValueTypeSetpoint {
+				zones = append(zones, climateZone{temperature: temperature, setpoint: setpoint})
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func (c *client) publishJSON(topic string, payload interface{}) error {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.publisher.Publish(topic, true, bytes)
+}
+
+func unitForValueType(valueType apiv1.ValueType) (unit, deviceClass string) {
+	switch valueType {
+	case apiv1.ValueTypeTemperature, apiv1.ValueTypeSetpoint, apiv1.ValueTypeOverrideSetpoint, apiv1.ValueTypeFloorTemperature:
+		return "°C", "temperature"
+	case apiv1.ValueTypeHeatDemand, apiv1.ValueTypeRelayDemand, apiv1.ValueTypeActuatorState:
+		return "%", ""
+	case apiv1.ValueTypeBatteryLevel:
+		return "%", "battery"
+	case apiv1.ValueTypeHumidity:
+		return "%", "humidity"
+	}
+
+	return "", ""
+}
+
+// slug turns names like Living room or overrideSetpoint into living_room and override_setpoint for use in topics
+func slug(name string) string {
+	var builder strings.Builder
+	lastUnderscore := true
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+			lastUnderscore = false
+		case r >= 'A' && r <= 'Z':
+			if i > 0 && !lastUnderscore && name[i-1] >= 'a' && name[i-1] <= 'z' {
+				builder.WriteRune('_')
+			}
+			builder.WriteRune(r + 'a' - 'A')
+			lastUnderscore = false
+		default:
+			if !lastUnderscore {
+				builder.WriteRune('_')
+				lastUnderscore = true
+			}
+		}
+	}
+
+	return strings.TrimSuffix(builder.String(), "_")
+}
@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMessage struct {
+	payload  string
+	retained bool
+}
+
+type fakePublisher struct {
+	messages map[string]fakeMessage
+	err      error
+	closed   bool
+}
+
+func newFakePublisher() *fakePublisher {
+	return &fakePublisher{messages: map[string]fakeMessage{}}
+}
+
+func (p *fakePublisher) Publish(topic string, retained bool, payload []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages[topic] = fakeMessage{payload: string(payload), retained: retained}
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	p.closed = true
+	return nil
+}
+
+func newTestConfig() apiv1.Config {
+	return apiv1.Config{
+		Location: "My Home",
+		SampleConfigs: []apiv1.ConfigSample{
+			{EntityType: contractsv1.EntityType_ENTITY_TYPE_ZONE, EntityName: "Uponor Smatrix T-169", SampleType: contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE, SampleName: "Living room", MetricType: contractsv1.MetricType_METRIC_TYPE_GAUGE, ThermostatID: "01:145038/00", ValueType: apiv1.ValueTypeTemperature},
+			{EntityType: contractsv1.EntityType_ENTITY_TYPE_ZONE, EntityName: "Uponor Smatrix T-169", SampleType: contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE_SETPOINT, SampleName: "Living room", MetricType: contractsv1.MetricType_METRIC_TYPE_GAUGE, ThermostatID: "01:145038/00", ValueType: apiv1.ValueTypeSetpoint},
+			{EntityType: contractsv1.EntityType_ENTITY_TYPE_ZONE, EntityName: "Uponor Smatrix T-169", SampleName: "Living room", MetricType: contractsv1.MetricType_METRIC_TYPE_GAUGE, ThermostatID: "01:145038/00", ValueType: apiv1.ValueTypeHeatDemand},
+			{EntityType: contractsv1.EntityType_ENTITY_TYPE_ZONE, EntityName: "Uponor Smatrix T-169", SampleType: contractsv1.SampleType_SAMPLE_TYPE_TEMPERATURE, SampleName: "Bathroom", MetricType: contractsv1.MetricType_METRIC_TYPE_GAUGE, ThermostatID: "01:145038/01", ValueType: apiv1.ValueTypeTemperature},
+		},
+	}
+}
+
+func newTestSample(sampleConfig apiv1.ConfigSample, value float64) *contractsv1.Sample {
+	return &contractsv1.Sample{
+		EntityType: sampleConfig.EntityType,
+		EntityName: sampleConfig.EntityName,
+		SampleType: sampleConfig.SampleType,
+		SampleName: sampleConfig.SampleName,
+		MetricType: sampleConfig.MetricType,
+		Value:      value,
+	}
+}
+
+func TestPublishMeasurement(t *testing.T) {
+	t.Run("PublishesRetainedValuePerZoneAndValueType", func(t *testing.T) {
+
+		config := newTestConfig()
+		publisher := newFakePublisher()
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+		measurement := contractsv1.Measurement{
+			Location: config.Location,
+			Samples: []*contractsv1.Sample{
+				newTestSample(config.SampleConfigs[0], 20.5),
+				newTestSample(config.SampleConfigs[1], 21),
+				newTestSample(config.SampleConfigs[2], 35),
+				newTestSample(config.SampleConfigs[3], 22.25),
+			},
+		}
+
+		// act
+		err = client.PublishMeasurement(measurement, config.SampleConfigs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, fakeMessage{payload: "20.5", retained: true}, publisher.messages["jarvis/uponor/my_home/living_room/temperature"])
+		assert.Equal(t, fakeMessage{payload: "21", retained: true}, publisher.messages["jarvis/uponor/my_home/living_room/setpoint"])
+		assert.Equal(t, fakeMessage{payload: "35", retained: true}, publisher.messages["jarvis/uponor/my_home/living_room/heat_demand"])
+		assert.Equal(t, fakeMessage{payload: "22.25", retained: true}, publisher.messages["jarvis/uponor/my_home/bathroom/temperature"])
+	})
+
+	t.Run("PublishesToTopicOfSampleConfigWhenSamplesLookAlike", func(t *testing.T) {
+
+		config := newTestConfig()
+		floorTemperature := config.SampleConfigs[0]
+		floorTemperature.ValueType = apiv1.ValueTypeFloorTemperature
+		config.SampleConfigs = append(config.SampleConfigs, floorTemperature)
+		publisher := newFakePublisher()
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+		// the room temperature has no reading, so only the identical looking floor temperature sample is measured
+		measurement := contractsv1.Measurement{
+			Samples: []*contractsv1.Sample{
+				newTestSample(floorTemperature, 25),
+			},
+		}
+
+		// act
+		err = client.PublishMeasurement(measurement, []apiv1.ConfigSample{floorTemperature})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(publisher.messages))
+		assert.Equal(t, "25", publisher.messages["jarvis/uponor/my_home/living_room/floor_temperature"].payload)
+	})
+
+	t.Run("ReturnsErrorIfSampleConfigsDontMatchSamples", func(t *testing.T) {
+
+		config := newTestConfig()
+		publisher := newFakePublisher()
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+		measurement := contractsv1.Measurement{
+			Samples: []*contractsv1.Sample{
+				newTestSample(config.SampleConfigs[0], 20.5),
+			},
+		}
+
+		// act
+		err = client.PublishMeasurement(measurement, config.SampleConfigs)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(publisher.messages))
+	})
+
+	t.Run("ReturnsErrorIfPublishingFails", func(t *testing.T) {
+
+		config := newTestConfig()
+		publisher := newFakePublisher()
+		publisher.err = fmt.Errorf("Broker unreachable")
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+		measurement := contractsv1.Measurement{
+			Samples: []*contractsv1.Sample{
+				newTestSample(config.SampleConfigs[0], 20.5),
+			},
+		}
+
+		// act
+		err = client.PublishMeasurement(measurement, config.SampleConfigs[:1])
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPublishDiscovery(t *testing.T) {
+	t.Run("PublishesSensorForEverySample", func(t *testing.T) {
+
+		config := newTestConfig()
+		publisher := newFakePublisher()
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+
+		// act
+		err = client.PublishDiscovery()
+
+		assert.Nil(t, err)
+		message, ok := publisher.messages["homeassistant/sensor/uponor_my_home_living_room_temperature/config"]
+		if assert.True(t, ok) {
+			assert.True(t, message.retained)
+			payload := sensorDiscovery{}
+			err = json.Unmarshal([]byte(message.payload), &payload)
+			assert.Nil(t, err)
+			assert.Equal(t, "Living room temperature", payload.Name)
+			assert.Equal(t, "jarvis/uponor/my_home/living_room/temperature", payload.StateTopic)
+			assert.Equal(t, "jarvis/uponor/my_home/status", payload.AvailabilityTopic)
+			assert.Equal(t, "temperature", payload.DeviceClass)
+			assert.Equal(t, "°C", payload.UnitOfMeasurement)
+			assert.Equal(t, []string{"uponor_my_home_living_room"}, payload.Device.Identifiers)
+		}
+		assert.Contains(t, publisher.messages, "homeassistant/sensor/uponor_my_home_living_room_setpoint/config")
+		assert.Contains(t, publisher.messages, "homeassistant/sensor/uponor_my_home_living_room_heat_demand/config")
+		assert.Contains(t, publisher.messages, "homeassistant/sensor/uponor_my_home_bathroom_temperature/config")
+	})
+
+	t.Run("PublishesClimateForZonesWithTemperatureAndSetpoint", func(t *testing.T) {
+
+		config := newTestConfig()
+		publisher := newFakePublisher()
+		client, err := NewClient(publisher, config, "jarvis/uponor", "homeassistant")
+		assert.Nil(t, err)
+
+		// act
+		err = client.PublishDiscovery()
+
+		assert.Nil(t, err)
+		message, ok := publisher.messages["homeassistant/climate/uponor_my_home_living_room_climate/config"]
+		if assert.True(t, ok) {
+			payload := climateDiscovery{}
+			err = json.Unmarshal([]byte(message.payload), &payload)
+			assert.Nil(t, err)
+			assert.Equal(t, "jarvis/uponor/my_home/living_room/temperature", payload.CurrentTemperatureTopic)
+			assert.Equal(t, "jarvis/uponor/my_home/living_room/setpoint", payload.TemperatureStateTopic)
+		}
+		assert.NotContains(t, publisher.messages, "homeassistant/climate/uponor_my_home_bathroom_climate/config")
+	})
+}
+
+func TestSlug(t *testing.T) {
+	t.Run("ReturnsLowerCaseWithUnderscores", func(t *testing.T) {
+
+		// act
+		assert.Equal(t, "living_room", slug("Living room"))
+		assert.Equal(t, "override_setpoint", slug("overrideSetpoint"))
+		assert.Equal(t, "my_home", slug(" My  Home! "))
+		assert.Equal(t, "01_145038_00", slug("01:145038/00"))
+	})
+}
@@ -0,0 +1,78 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+
+	publishTimeout = 10 * time.Second
+)
+
+// Publisher sends messages to an mqtt broker
+type Publisher interface {
+	Publish(topic string, retained bool, payload []byte) error
+	Close() error
+}
+
+// NewPublisher connects to the broker at brokerURL like tcp://localhost:1883; availabilityTopic is set to online
+// on every (re)connect and to offline by the broker when the connection drops
+func NewPublisher(brokerURL, clientID, username, password, availabilityTopic string) (Publisher, error) {
+	options := paho.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(publishTimeout).
+		SetWill(availabilityTopic, payloadOffline, 1, true).
+		SetOnConnectHandler(func(pahoClient paho.Client) {
+			token := pahoClient.Publish(availabilityTopic, 1, true, payloadOnline)
+			if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+				log.Warn().Err(token.Error()).Msgf("Failed publishing availability to %v", availabilityTopic)
+			}
+		})
+
+	pahoClient := paho.NewClient(options)
+	token := pahoClient.Connect()
+	if !token.WaitTimeout(publishTimeout) {
+		return nil, fmt.Errorf("Connecting to mqtt broker %v timed out", brokerURL)
+	}
+	if token.Error() != nil {
+		return nil, fmt.Errorf("Connecting to mqtt broker %v failed: %w", brokerURL, token.Error())
+	}
+
+	return &pahoPublisher{
+		client:            pahoClient,
+		availabilityTopic: availabilityTopic,
+	}, nil
+}
+
+type pahoPublisher struct {
+	client            paho.Client
+	availabilityTopic string
+}
+
+func (p *pahoPublisher) Publish(topic string, retained bool, payload []byte) error {
+	token := p.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("Publishing to %v timed out", topic)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("Publishing to %v failed: %w", topic, token.Error())
+	}
+	return nil
+}
+
+// Close marks the exporter offline, since a clean disconnect doesn't trigger the will message
+func (p *pahoPublisher) Close() error {
+	err := p.Publish(p.availabilityTopic, true, []byte(payloadOffline))
+	p.client.Disconnect(250)
+	return err
+}
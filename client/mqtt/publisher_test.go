@@ -0,0 +1,173 @@
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeToken struct {
+	completed bool
+	err       error
+}
+
+func (t *fakeToken) Wait() bool {
+	return t.completed
+}
+
+func (t *fakeToken) WaitTimeout(time.Duration) bool {
+	return t.completed
+}
+
+func (t *fakeToken) Error() error {
+	return t.err
+}
+
+type fakePublishedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  string
+}
+
+// fakePahoClient implements the methods of paho.Client the publisher uses; calling any other method panics
+type fakePahoClient struct {
+	paho.Client
+	token        *fakeToken
+	published    []fakePublishedMessage
+	disconnected bool
+}
+
+func (c *fakePahoClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.published = append(c.published, fakePublishedMessage{topic: topic, qos: qos, retained: retained, payload: string(payload.([]byte))})
+	return c.token
+}
+
+func (c *fakePahoClient) Disconnect(quiesce uint) {
+	c.disconnected = true
+}
+
+// startFakeBroker accepts every connect and acknowledges every qos 1 publish, and sends the published messages to the
+// returned channel
+func startFakeBroker(t *testing.T) (brokerURL string, published chan fakePublishedMessage, stop func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published = make(chan fakePublishedMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeBrokerConnection(conn, published)
+		}
+	}()
+
+	return "tcp://" + listener.Addr().String(), published, func() { listener.Close() }
+}
+
+func serveFakeBrokerConnection(conn net.Conn, published chan fakePublishedMessage) {
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.ReturnCode = packets.Accepted
+			connack.Write(conn)
+		case *packets.PublishPacket:
+			published <- fakePublishedMessage{topic: p.TopicName, qos: p.Qos, retained: p.Retain, payload: string(p.Payload)}
+			puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+			puback.MessageID = p.MessageID
+			puback.Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	t.Run("PublishesOnlineAndValuesToBroker", func(t *testing.T) {
+
+		brokerURL, published, stop := startFakeBroker(t)
+		defer stop()
+
+		// act
+		publisher, err := NewPublisher(brokerURL, "test", "", "", "jarvis/uponor/my_home/status")
+
+		if assert.Nil(t, err) {
+			assert.Equal(t, fakePublishedMessage{topic: "jarvis/uponor/my_home/status", qos: 1, retained: true, payload: "online"}, <-published)
+
+			err = publisher.Publish("jarvis/uponor/my_home/living_room/temperature", true, []byte("20.5"))
+			assert.Nil(t, err)
+			assert.Equal(t, fakePublishedMessage{topic: "jarvis/uponor/my_home/living_room/temperature", qos: 1, retained: true, payload: "20.5"}, <-published)
+
+			err = publisher.Close()
+			assert.Nil(t, err)
+			assert.Equal(t, fakePublishedMessage{topic: "jarvis/uponor/my_home/status", qos: 1, retained: true, payload: "offline"}, <-published)
+		}
+	})
+}
+
+func TestPahoPublisherPublish(t *testing.T) {
+	t.Run("PublishesWithQOS1", func(t *testing.T) {
+
+		pahoClient := &fakePahoClient{token: &fakeToken{completed: true}}
+		publisher := &pahoPublisher{client: pahoClient, availabilityTopic: "jarvis/uponor/my_home/status"}
+
+		// act
+		err := publisher.Publish("jarvis/uponor/my_home/living_room/temperature", true, []byte("20.5"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []fakePublishedMessage{{topic: "jarvis/uponor/my_home/living_room/temperature", qos: 1, retained: true, payload: "20.5"}}, pahoClient.published)
+	})
+
+	t.Run("ReturnsErrorIfPublishingFails", func(t *testing.T) {
+
+		pahoClient := &fakePahoClient{token: &fakeToken{completed: true, err: fmt.Errorf("Not connected")}}
+		publisher := &pahoPublisher{client: pahoClient}
+
+		// act
+		err := publisher.Publish("jarvis/uponor/my_home/living_room/temperature", true, []byte("20.5"))
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfPublishingTimesOut", func(t *testing.T) {
+
+		pahoClient := &fakePahoClient{token: &fakeToken{completed: false}}
+		publisher := &pahoPublisher{client: pahoClient}
+
+		// act
+		err := publisher.Publish("jarvis/uponor/my_home/living_room/temperature", true, []byte("20.5"))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPahoPublisherClose(t *testing.T) {
+	t.Run("PublishesOfflineAndDisconnects", func(t *testing.T) {
+
+		pahoClient := &fakePahoClient{token: &fakeToken{completed: true}}
+		publisher := &pahoPublisher{client: pahoClient, availabilityTopic: "jarvis/uponor/my_home/status"}
+
+		// act
+		err := publisher.Close()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []fakePublishedMessage{{topic: "jarvis/uponor/my_home/status", qos: 1, retained: true, payload: "offline"}}, pahoClient.published)
+		assert.True(t, pahoClient.disconnected)
+	})
+}
@@ -0,0 +1,354 @@
+package pulse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Client is the interface for polling the local api of an Uponor Smatrix Pulse R-208 gateway, which offers the same
+// measurements, samples and statistics as antenna.Client
+type Client interface {
+	Listen(ctx context.Context) (err error)
+	GetStatistics() antenna.Statistics
+	GetDevices() []antenna.Device
+	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error)
+	GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error)
+}
+
+const (
+	// the gateway serves all its variables in a single jnap call
+	jnapPath                = "/JNAP/"
+	jnapActionHeader        = "x-jnap-action"
+	getAttributesAction     = "http://phyn.com/jnap/uponorsky/GetAttributes"
+	opcodeGetAttributes     = protocol.Opcode("GetAttributes")
+	requestTimeout          = 10 * time.Second
+	temperatureUnavailable  = 32767
+	thermostatPresenceValue = "1"
+)
+
+// variable names are prefixed with the controller and thermostat like C1_T1_room_temperature
+var thermostatVariableRegex = regexp.MustCompile(`^(C\d+_T\d+)_(.+)$`)
+
+// variableForValueType is the variable suffix holding each value type
+var variableForValueType = map[apiv1.ValueType]string{
+	apiv1.ValueTypeTemperature:      "room_temperature",
+	apiv1.ValueTypeSetpoint:         "room_setpoint",
+	apiv1.ValueTypeFloorTemperature: "external_temperature",
+	apiv1.ValueTypeHumidity:         "rh",
+	apiv1.ValueTypeHeatDemand:       "room_in_demand",
+	apiv1.ValueTypeBatteryLow:       "stat_battery_error",
+}
+
+// NewClient returns new pulse.Client for a gateway url like http://192.168.1.10
+func NewClient(gatewayURL string, pollInterval time.Duration) (Client, error) {
+	if gatewayURL == "" {
+		return nil, fmt.Errorf("Please set the url of the Smatrix Pulse gateway")
+	}
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("Please set a poll interval larger than 0")
+	}
+
+	return &client{
+		gatewayURL:   strings.TrimRight(gatewayURL, "/"),
+		pollInterval: pollInterval,
+		httpClient:   &http.Client{Timeout: requestTimeout},
+		devices:      map[protocol.Address]*antenna.Device{},
+	}, nil
+}
+
+type client struct {
+	gatewayURL   string
+	pollInterval time.Duration
+	httpClient   *http.Client
+
+	mutex              sync.RWMutex
+	variables          map[string]string
+	connected          bool
+	lastPoll           time.Time
+	lastSuccessfulPoll time.Time
+	polls              uint64
+	pollFailures       uint64
+	connectionResets   uint64
+	devices            map[protocol.Address]*antenna.Device
+
+	staleTracker antenna.StaleTracker
+}
+
+type getAttributesResponse struct {
+	Result string `json:"result"`
+	Output struct {
+		Vars []struct {
+			Name  string `json:"waspVarName"`
+			Value string `json:"waspVarValue"`
+		} `json:"vars"`
+	} `json:"output"`
+}
+
+// Listen polls the gateway every poll interval until the context is cancelled; failed polls are retried at the next
+// interval
+func (c *client) Listen(ctx context.Context) (err error) {
+
+	log.Info().Msgf("Polling Smatrix Pulse gateway %v every %v...", c.gatewayURL, c.pollInterval)
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := c.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msgf("Failed polling Smatrix Pulse gateway %v", c.gatewayURL)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Received cancellation, stopped polling Smatrix Pulse gateway")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches all variables from the gateway and replaces the previous ones
+func (c *client) poll(ctx context.Context) (err error) {
+	variables, err := c.getAttributes(ctx)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now().UTC()
+	c.lastPoll = now
+	if err != nil {
+		c.pollFailures++
+		if c.connected {
+			c.connectionResets++
+		}
+		c.connected = false
+		return err
+	}
+
+	c.connected = true
+	c.lastSuccessfulPoll = now
+	c.polls++
+	c.variables = variables
+	c.updateDevices(now)
+
+	return nil
+}
+
+func (c *client) getAttributes(ctx context.Context) (variables map[string]string, err error) {
+	request, err := http.NewRequest(http.MethodPost, c.gatewayURL+jnapPath, bytes.NewBufferString("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating request for gateway: %w", err)
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(jnapActionHeader, getAttributesAction)
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Failed requesting attributes from gateway: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading attributes from gateway: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Gateway returned status %v: %v", response.StatusCode, string(body))
+	}
+
+	var attributes getAttributesResponse
+	err = json.Unmarshal(body, &attributes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed unmarshalling attributes from gateway: %w", err)
+	}
+	if attributes.Result != "OK" {
+		return nil, fmt.Errorf("Gateway returned result %v", attributes.Result)
+	}
+
+	variables = map[string]string{}
+	for _, v := range attributes.Output.Vars {
+		variables[v.Name] = v.Value
+	}
+
+	return variables, nil
+}
+
+// updateDevices keeps a device for every thermostat the gateway reports as present; the mutex has to be held
+func (c *client) updateDevices(pollTime time.Time) {
+	for name, value := range c.variables {
+		matches := thermostatVariableRegex.FindStringSubmatch(name)
+		if matches == nil || matches[2] != "thermostat_presence" || value != thermostatPresenceValue {
+			continue
+		}
+
+		address := protocol.Address(matches[1])
+		device, ok := c.devices[address]
+		if !ok {
+			device = &antenna.Device{
+				Address:   address,
+				FirstSeen: pollTime,
+				Opcodes:   map[protocol.Opcode]uint64{},
+			}
+			c.devices[address] = device
+		}
+		device.LastSeen = pollTime
+		device.Frames++
+		device.Opcodes[opcodeGetAttributes]++
+	}
+}
+
+// GetStatistics returns the poll statistics in the form of antenna statistics, with every successful poll counting as
+// a valid frame and every failed poll as a parse failure
+func (c *client) GetStatistics() antenna.Statistics {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return antenna.Statistics{
+		Connected:           c.connected,
+		LastReceivedMessage: c.lastPoll,
+		LastValidFrame:      c.lastSuccessfulPoll,
+		FramesReceived:      map[protocol.Opcode]uint64{opcodeGetAttributes: c.polls},
+		ParseFailures:       c.pollFailures,
+		ConnectionResets:    c.connectionResets,
+		StaleSamples:        c.staleTracker.StaleSamples(),
+		QuietThermostats:    c.staleTracker.QuietThermostats(),
+	}
+}
+
+// GetDevices returns the thermostats present on the gateway, ordered by address
+func (c *client) GetDevices() []antenna.Device {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	devices := []antenna.Device{}
+	for _, d := range c.devices {
+		device := *d
+		device.Opcodes = map[protocol.Opcode]uint64{}
+		for opcode, count := range d.Opcodes {
+			device.Opcodes[opcode] = count
+		}
+		device.ValueTypes = map[int][]apiv1.ValueType{}
+		for valueType := range variableForValueType {
+			if _, err := c.getValue(string(d.Address), valueType); err == nil {
+				device.ValueTypes[0] = append(device.ValueTypes[0], valueType)
+			}
+		}
+		sort.Slice(device.ValueTypes[0], func(i, j int) bool { return device.ValueTypes[0][i] < device.ValueTypes[0][j] })
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Address < devices[j].Address })
+
+	return devices
+}
+
+func (c *client) GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error) {
+
+	log.Info().Msg("Taking measurement from latest polled values...")
+
+	measurement = contractsv1.Measurement{
+		ID:             uuid.New().String(),
+		Source:         "jarvis-uponor-smatrix-exporter",
+		Location:       config.Location,
+		Samples:        []*contractsv1.Sample{},
+		MeasuredAtTime: time.Now().UTC(),
+	}
+
+	for _, sc := range config.SampleConfigs {
+		sample, sampleErr := c.GetSample(config, sc)
+		if c.staleTracker.Update(sc.ThermostatID, sc.ValueType, sampleErr) {
+			continue
+		}
+		if sampleErr != nil {
+			log.Warn().Err(sampleErr).Msgf("Skipping sample %v for %v", sc.SampleName, sc.ThermostatID)
+			continue
+		}
+		measurement.Samples = append(measurement.Samples, &sample)
+		sampleConfigs = append(sampleConfigs, sc)
+	}
+	c.staleTracker.UpdateQuiet()
+
+	return
+}
+
+// GetSample returns the value for a thermostat id like C1_T1, which is the controller and thermostat number as used in
+// the variable names of the gateway
+func (c *client) GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error) {
+
+	// init sample from config
+	sample = contractsv1.Sample{
+		EntityType: sampleConfig.EntityType,
+		EntityName: sampleConfig.EntityName,
+		SampleType: sampleConfig.SampleType,
+		SampleName: sampleConfig.SampleName,
+		MetricType: sampleConfig.MetricType,
+	}
+
+	c.mutex.RLock()
+	value, err := c.getValue(sampleConfig.ThermostatID, sampleConfig.ValueType)
+	lastSuccessfulPoll := c.lastSuccessfulPoll
+	c.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	// all variables are as old as the last poll that returned them
+	err = antenna.CheckAge(config, sampleConfig, lastSuccessfulPoll, time.Now().UTC())
+	if err != nil {
+		return
+	}
+
+	// correct value
+	sample.Value = value * sampleConfig.ValueMultiplier
+
+	return
+}
+
+// getValue converts a variable of a thermostat into the unit used for its value type; the mutex has to be held
+func (c *client) getValue(thermostatID string, valueType apiv1.ValueType) (value float64, err error) {
+	suffix, ok := variableForValueType[valueType]
+	if !ok {
+		return value, fmt.Errorf("Value type %v is not supported by the Smatrix Pulse gateway", valueType)
+	}
+
+	raw, ok := c.variables[thermostatID+"_"+suffix]
+	if !ok || raw == "" {
+		return value, fmt.Errorf("No %v reading available for thermostat %v", valueType, thermostatID)
+	}
+	number, err := strconv.Atoi(raw)
+	if err != nil {
+		return value, fmt.Errorf("Variable %v_%v with value %q is not a number: %w", thermostatID, suffix, raw, err)
+	}
+
+	switch valueType {
+	case apiv1.ValueTypeTemperature, apiv1.ValueTypeSetpoint, apiv1.ValueTypeFloorTemperature:
+		if number == temperatureUnavailable {
+			return value, fmt.Errorf("No %v reading available for thermostat %v", valueType, thermostatID)
+		}
+		// temperatures are in tenths of a degree Fahrenheit
+		return math.Round((float64(number)/10-32)/1.8*100) / 100, nil
+	case apiv1.ValueTypeHeatDemand:
+		return float64(number) * 100, nil
+	}
+
+	return float64(number), nil
+}
@@ -0,0 +1,181 @@
+package pulse
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSample(t *testing.T) {
+	t.Run("ReturnsValuesOfThermostat", func(t *testing.T) {
+
+		c := newPolledTestClient(t)
+
+		// act
+		temperature, temperatureErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeTemperature})
+		setpoint, setpointErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeSetpoint})
+		humidity, humidityErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeHumidity})
+		demand, demandErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeHeatDemand})
+		floor, floorErr := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T2", ValueType: apiv1.ValueTypeFloorTemperature})
+
+		assert.Nil(t, temperatureErr)
+		assert.Nil(t, setpointErr)
+		assert.Nil(t, humidityErr)
+		assert.Nil(t, demandErr)
+		assert.Nil(t, floorErr)
+		assert.Equal(t, 20.5, temperature.Value)
+		assert.Equal(t, 21.0, setpoint.Value)
+		assert.Equal(t, 45.0, humidity.Value)
+		assert.Equal(t, 100.0, demand.Value)
+		assert.Equal(t, 25.0, floor.Value)
+	})
+
+	t.Run("ReturnsErrorForMissingFloorSensor", func(t *testing.T) {
+
+		c := newPolledTestClient(t)
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeFloorTemperature})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForUnsupportedValueType", func(t *testing.T) {
+
+		c := newPolledTestClient(t)
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeRSSI})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorBeforeFirstPoll", func(t *testing.T) {
+
+		c, _ := NewClient("http://localhost", time.Minute)
+
+		// act
+		_, err := c.GetSample(apiv1.Config{}, apiv1.ConfigSample{ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeTemperature})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetMeasurement(t *testing.T) {
+	t.Run("ReturnsMeasurementWithAvailableSamples", func(t *testing.T) {
+
+		c := newPolledTestClient(t)
+		config := apiv1.Config{
+			Location: "My Home",
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Living room", ValueMultiplier: 1, ThermostatID: "C1_T1", ValueType: apiv1.ValueTypeTemperature},
+				{SampleName: "Bedroom", ValueMultiplier: 1, ThermostatID: "C1_T3", ValueType: apiv1.ValueTypeTemperature},
+			},
+		}
+
+		// act
+		measurement, _, err := c.GetMeasurement(config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "My Home", measurement.Location)
+		if assert.Equal(t, 1, len(measurement.Samples)) {
+			assert.Equal(t, "Living room", measurement.Samples[0].SampleName)
+		}
+	})
+}
+
+func TestGetDevices(t *testing.T) {
+	t.Run("ReturnsPresentThermostatsWithAvailableValues", func(t *testing.T) {
+
+		c := newPolledTestClient(t)
+
+		// act
+		devices := c.GetDevices()
+
+		if assert.Equal(t, 2, len(devices)) {
+			assert.Equal(t, protocol.Address("C1_T1"), devices[0].Address)
+			assert.Equal(t, []apiv1.ValueType{apiv1.ValueTypeBatteryLow, apiv1.ValueTypeHeatDemand, apiv1.ValueTypeHumidity, apiv1.ValueTypeSetpoint, apiv1.ValueTypeTemperature}, devices[0].ValueTypes[0])
+			assert.Equal(t, protocol.Address("C1_T2"), devices[1].Address)
+		}
+	})
+}
+
+func TestListen(t *testing.T) {
+	t.Run("PostsJNAPRequestAndCountsPolls", func(t *testing.T) {
+
+		requests := make(chan *http.Request, 10)
+		server := newTestServer(t, requests, http.StatusOK)
+		defer server.Close()
+		c, _ := NewClient(server.URL, time.Hour)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// act
+		done := make(chan error)
+		go func() { done <- c.Listen(ctx) }()
+		request := <-requests
+		assert.Eventually(t, func() bool { return c.GetStatistics().Connected }, time.Second, time.Millisecond)
+		cancel()
+
+		assert.Nil(t, <-done)
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, "/JNAP/", request.URL.Path)
+		assert.Equal(t, "http://phyn.com/jnap/uponorsky/GetAttributes", request.Header.Get("x-jnap-action"))
+		statistics := c.GetStatistics()
+		assert.True(t, statistics.Connected)
+		assert.Equal(t, uint64(1), statistics.FramesReceived["GetAttributes"])
+	})
+
+	t.Run("CountsFailedPolls", func(t *testing.T) {
+
+		server := newTestServer(t, nil, http.StatusInternalServerError)
+		defer server.Close()
+		c, _ := NewClient(server.URL, time.Hour)
+
+		// act
+		err := c.(*client).poll(context.Background())
+
+		assert.NotNil(t, err)
+		statistics := c.GetStatistics()
+		assert.False(t, statistics.Connected)
+		assert.Equal(t, uint64(1), statistics.ParseFailures)
+	})
+}
+
+func newTestServer(t *testing.T, requests chan *http.Request, statusCode int) *httptest.Server {
+	response, err := ioutil.ReadFile("./test-response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		w.Write(response)
+		if requests != nil {
+			requests <- r
+		}
+	}))
+}
+
+// newPolledTestClient returns a client that polled the recorded response once, so the server isn't needed anymore
+func newPolledTestClient(t *testing.T) Client {
+	server := newTestServer(t, nil, http.StatusOK)
+	defer server.Close()
+
+	c, err := NewClient(server.URL, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.(*client).poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
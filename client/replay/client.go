@@ -0,0 +1,142 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/scheduler"
+	"github.com/rs/zerolog/log"
+)
+
+// Client is the interface for replaying a capture file through the decoding and measurement pipeline
+type Client interface {
+	Replay(ctx context.Context, capturePath string, config apiv1.Config) (err error)
+}
+
+// NewClient returns new replay.Client; a speed of 1 replays at original speed, 60 a minute per second and 0 as fast as
+// possible
+func NewClient(antennaClient antenna.ReplayClient, schedulerClient scheduler.Client, interval time.Duration, speed float64) (Client, error) {
+	if antennaClient == nil {
+		return nil, fmt.Errorf("Please set the antenna replay client")
+	}
+	if schedulerClient == nil {
+		return nil, fmt.Errorf("Please set the scheduler client")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Please set a measurement interval larger than 0")
+	}
+	if speed < 0 {
+		return nil, fmt.Errorf("Please set a replay speed of 0 or larger")
+	}
+
+	return &client{
+		antennaClient:   antennaClient,
+		schedulerClient: schedulerClient,
+		interval:        interval,
+		speed:           speed,
+	}, nil
+}
+
+type client struct {
+	antennaClient   antenna.ReplayClient
+	schedulerClient scheduler.Client
+	interval        time.Duration
+	speed           float64
+}
+
+func (c *client) Replay(ctx context.Context, capturePath string, config apiv1.Config) (err error) {
+
+	log.Info().Msgf("Replaying capture file %v at speed %v...", capturePath, c.speed)
+
+	f, err := os.Open(capturePath)
+	if err != nil {
+		return fmt.Errorf("Failed opening capture file %v: %w", capturePath, err)
+	}
+	defer f.Close()
+
+	var replayTime, nextMeasurementTime time.Time
+	lines, unmeasuredLines := 0, 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record, err := antenna.ParseCaptureLine(scanner.Text())
+		if err != nil {
+			log.Warn().Err(err).Msg("Skipping unreadable capture line")
+			continue
+		}
+
+		// plain antenna lines without timestamp keep the time of the previous line
+		if !record.Timestamp.IsZero() && record.Timestamp.After(replayTime) {
+			if !replayTime.IsZero() {
+				err = c.wait(ctx, record.Timestamp.Sub(replayTime))
+				if err != nil {
+					return err
+				}
+			}
+			replayTime = record.Timestamp
+		}
+
+		// take the measurements that would have been taken in live mode before this line got received
+		if !replayTime.IsZero() {
+			if nextMeasurementTime.IsZero() {
+				nextMeasurementTime = replayTime.Truncate(c.interval).Add(c.interval)
+			}
+			for !replayTime.Before(nextMeasurementTime) {
+				c.measure(nextMeasurementTime, config)
+				nextMeasurementTime = nextMeasurementTime.Add(c.interval)
+				unmeasuredLines = 0
+			}
+		}
+
+		c.antennaClient.SetTime(replayTime)
+		c.antennaClient.HandleLine(record.Raw)
+		lines++
+		unmeasuredLines++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed reading capture file %v: %w", capturePath, err)
+	}
+
+	// without any timestamp there's no time to store the measurements at
+	if lines > 0 && replayTime.IsZero() {
+		return fmt.Errorf("Capture file %v has no timestamped lines, please record it with --capture-enable", capturePath)
+	}
+
+	// the lines after the last interval boundary would otherwise never reach the sinks
+	if unmeasuredLines > 0 {
+		c.measure(replayTime, config)
+	}
+
+	log.Info().Msgf("Replayed %v lines from capture file %v", lines, capturePath)
+
+	return nil
+}
+
+func (c *client) measure(measurementTime time.Time, config apiv1.Config) {
+	c.antennaClient.SetTime(measurementTime)
+
+	err := c.schedulerClient.Measure(config)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed storing replayed measurement for %v", measurementTime)
+	}
+}
+
+// wait sleeps for the time between two lines divided by the replay speed
+func (c *client) wait(ctx context.Context, gap time.Duration) (err error) {
+	if c.speed == 0 || gap <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(float64(gap) / c.speed)):
+		return nil
+	}
+}
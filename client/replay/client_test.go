@@ -0,0 +1,164 @@
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+const capture = `{"ts":"2020-10-11T22:00:30Z","raw":"045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0"}
+{"ts":"2020-10-11T22:02:00Z","raw":"# evofw3 0.7.0"}
+{"ts":"2020-10-11T22:04:00Z","raw":"045  I --- 34:092243 --:------ 34:092243 30C9 003 0007E4"}
+045  I --- 34:092243 --:------ 34:092243 2309 003 000834
+{"ts":"2020-10-11T22:16:00Z","raw":"045  I --- 34:092243 --:------ 34:092243 30C9 003 0007F8"}
+`
+
+func TestReplay(t *testing.T) {
+	t.Run("StoresMeasurementsAtReplayedIntervals", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "replay")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.jsonl")
+		err = ioutil.WriteFile(path, []byte(capture), 0644)
+		assert.Nil(t, err)
+
+		stored := []contractsv1.Measurement{}
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored = append(stored, measurement)
+			return nil
+		}
+		antennaClient, err := antenna.NewReplayClient(nil)
+		assert.Nil(t, err)
+		schedulerClient, err := scheduler.NewClient(antennaClient, 5*time.Minute, &sync.WaitGroup{}, sink)
+		assert.Nil(t, err)
+		client, err := NewClient(antennaClient, schedulerClient, 5*time.Minute, 0)
+		assert.Nil(t, err)
+
+		config := apiv1.Config{
+			Location: "My address",
+			SampleConfigs: []apiv1.ConfigSample{
+				{SampleName: "Temperature", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature},
+				{SampleName: "Setpoint", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeSetpoint},
+			},
+		}
+
+		// act
+		err = client.Replay(context.Background(), path, config)
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 4, len(stored)) {
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 5, 0, 0, time.UTC), stored[0].MeasuredAtTime)
+			assert.Equal(t, 2, len(stored[0].Samples))
+			assert.Equal(t, 20.2, stored[0].Samples[0].Value)
+			assert.Equal(t, 21.0, stored[0].Samples[1].Value)
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 15, 0, 0, time.UTC), stored[2].MeasuredAtTime)
+			// the last line gets measured at its own timestamp
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 16, 0, 0, time.UTC), stored[3].MeasuredAtTime)
+			assert.Equal(t, 20.4, stored[3].Samples[0].Value)
+		}
+	})
+
+	t.Run("StoresSameMeasurementIDsWhenReplayedAgain", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "replay")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.jsonl")
+		err = ioutil.WriteFile(path, []byte(capture), 0644)
+		assert.Nil(t, err)
+		config := apiv1.Config{
+			Location:      "My address",
+			SampleConfigs: []apiv1.ConfigSample{{SampleName: "Temperature", ValueMultiplier: 1, ThermostatID: "34:092243", ValueType: apiv1.ValueTypeTemperature}},
+		}
+
+		replayIDs := func() (ids []string) {
+			sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+				ids = append(ids, measurement.ID)
+				return nil
+			}
+			antennaClient, _ := antenna.NewReplayClient(nil)
+			schedulerClient, _ := scheduler.NewClient(antennaClient, 5*time.Minute, &sync.WaitGroup{}, sink)
+			client, _ := NewClient(antennaClient, schedulerClient, 5*time.Minute, 0)
+			err := client.Replay(context.Background(), path, config)
+			assert.Nil(t, err)
+			return ids
+		}
+
+		// act
+		first := replayIDs()
+		second := replayIDs()
+
+		assert.Equal(t, 4, len(first))
+		assert.Equal(t, first, second)
+		assert.NotEqual(t, first[0], first[1])
+	})
+
+	t.Run("ReturnsErrorForCaptureWithoutTimestamps", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "replay")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.log")
+		err = ioutil.WriteFile(path, []byte("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0\n"), 0644)
+		assert.Nil(t, err)
+
+		stored := []contractsv1.Measurement{}
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored = append(stored, measurement)
+			return nil
+		}
+		antennaClient, _ := antenna.NewReplayClient(nil)
+		schedulerClient, _ := scheduler.NewClient(antennaClient, 5*time.Minute, &sync.WaitGroup{}, sink)
+		client, _ := NewClient(antennaClient, schedulerClient, 5*time.Minute, 0)
+
+		// act
+		err = client.Replay(context.Background(), path, apiv1.Config{})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(stored))
+	})
+
+	t.Run("ReturnsErrorForMissingCaptureFile", func(t *testing.T) {
+
+		antennaClient, _ := antenna.NewReplayClient(nil)
+		schedulerClient, _ := scheduler.NewClient(antennaClient, 5*time.Minute, &sync.WaitGroup{})
+		client, _ := NewClient(antennaClient, schedulerClient, 5*time.Minute, 0)
+
+		// act
+		err := client.Replay(context.Background(), "/does/not/exist.jsonl", apiv1.Config{})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("StopsWhenContextIsCancelled", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "replay")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "capture.jsonl")
+		err = ioutil.WriteFile(path, []byte(capture), 0644)
+		assert.Nil(t, err)
+
+		antennaClient, _ := antenna.NewReplayClient(nil)
+		schedulerClient, _ := scheduler.NewClient(antennaClient, 5*time.Minute, &sync.WaitGroup{})
+		client, _ := NewClient(antennaClient, schedulerClient, 5*time.Minute, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		err = client.Replay(ctx, path, apiv1.Config{})
+
+		assert.Equal(t, context.Canceled, err)
+	})
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// MeasurementSource takes a measurement from the latest received values, like antenna.Client does
+type MeasurementSource interface {
+	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error)
+}
+
+// Sink stores a measurement, for example in a BigQuery table; sampleConfigs holds the config of every sample in the same
+// order as the samples of the measurement
+type Sink func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error
+
+// Client is the interface for periodically storing measurements
+type Client interface {
+	Run(ctx context.Context, config apiv1.Config)
+	Measure(config apiv1.Config) (err error)
+	LastSuccessfulStore() time.Time
+}
+
+// NewClient returns new scheduler.Client
+func NewClient(source MeasurementSource, interval time.Duration, waitGroup *sync.WaitGroup, sinks ...Sink) (Client, error) {
+	if source == nil {
+		return nil, fmt.Errorf("Please set the source for measurements")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Please set a measurement interval larger than 0")
+	}
+
+	return &client{
+		source:    source,
+		interval:  interval,
+		waitGroup: waitGroup,
+		sinks:     sinks,
+	}, nil
+}
+
+type client struct {
+	source    MeasurementSource
+	interval  time.Duration
+	waitGroup *sync.WaitGroup
+	sinks     []Sink
+
+	mutex               sync.RWMutex
+	lastSuccessfulStore time.Time
+}
+
+// Run takes and stores a measurement every interval until the context is cancelled
+func (c *client) Run(ctx context.Context, config apiv1.Config) {
+
+	log.Info().Msgf("Storing a measurement every %v...", c.interval)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Received cancellation, stopping measurements")
+			return
+		case <-ticker.C:
+			err := c.Measure(config)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed storing measurement")
+			}
+		}
+	}
+}
+
+// Measure takes a single measurement and hands it to all sinks
+func (c *client) Measure(config apiv1.Config) (err error) {
+
+	// make graceful shutdown wait for the measurement to be stored
+	c.waitGroup.Add(1)
+	defer c.waitGroup.Done()
+
+	measurement, sampleConfigs, err := c.source.GetMeasurement(config)
+	if err != nil {
+		return fmt.Errorf("Failed getting measurement: %w", err)
+	}
+
+	// without samples there's nothing to store, but the sinks aren't failing either
+	if len(measurement.Samples) == 0 {
+		log.Info().Msg("Measurement has no samples, skipping")
+		c.setLastSuccessfulStore()
+		return nil
+	}
+
+	var lastErr error
+	for i, sink := range c.sinks {
+		if sinkErr := sink(measurement, sampleConfigs); sinkErr != nil {
+			log.Warn().Err(sinkErr).Msgf("Failed storing measurement in sink %v", i)
+			lastErr = sinkErr
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("Failed storing measurement in one or more sinks: %w", lastErr)
+	}
+
+	c.setLastSuccessfulStore()
+
+	log.Info().Msgf("Stored %v samples", len(measurement.Samples))
+
+	return nil
+}
+
+func (c *client) setLastSuccessfulStore() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastSuccessfulStore = time.Now().UTC()
+}
+
+// LastSuccessfulStore returns when a measurement got stored in all sinks for the last time
+func (c *client) LastSuccessfulStore() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.lastSuccessfulStore
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	samples []*contractsv1.Sample
+	err     error
+}
+
+func (s *fakeSource) GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error) {
+	return contractsv1.Measurement{
+		ID:       "abc",
+		Location: config.Location,
+		Samples:  s.samples,
+	}, make([]apiv1.ConfigSample, len(s.samples)), s.err
+}
+
+func TestMeasure(t *testing.T) {
+	t.Run("HandsMeasurementToAllSinks", func(t *testing.T) {
+
+		source := &fakeSource{samples: []*contractsv1.Sample{{SampleName: "Living room", Value: 20}}}
+		stored := []contractsv1.Measurement{}
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored = append(stored, measurement)
+			return nil
+		}
+		client, err := NewClient(source, time.Minute, &sync.WaitGroup{}, sink, sink)
+		assert.Nil(t, err)
+
+		// act
+		err = client.Measure(apiv1.Config{Location: "My address"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(stored))
+		assert.Equal(t, "My address", stored[0].Location)
+		assert.False(t, client.LastSuccessfulStore().IsZero())
+	})
+
+	t.Run("SkipsMeasurementWithoutSamples", func(t *testing.T) {
+
+		stored := 0
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored++
+			return nil
+		}
+		client, err := NewClient(&fakeSource{}, time.Minute, &sync.WaitGroup{}, sink)
+		assert.Nil(t, err)
+
+		// act
+		err = client.Measure(apiv1.Config{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, stored)
+		assert.False(t, client.LastSuccessfulStore().IsZero())
+	})
+
+	t.Run("ReturnsErrorButStillCallsOtherSinksWhenSinkFails", func(t *testing.T) {
+
+		source := &fakeSource{samples: []*contractsv1.Sample{{SampleName: "Living room", Value: 20}}}
+		stored := 0
+		failingSink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			return fmt.Errorf("Unreachable")
+		}
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored++
+			return nil
+		}
+		client, err := NewClient(source, time.Minute, &sync.WaitGroup{}, failingSink, sink)
+		assert.Nil(t, err)
+
+		// act
+		err = client.Measure(apiv1.Config{})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, stored)
+		assert.True(t, client.LastSuccessfulStore().IsZero())
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("StoresMeasurementEveryIntervalUntilCancelled", func(t *testing.T) {
+
+		source := &fakeSource{samples: []*contractsv1.Sample{{SampleName: "Living room", Value: 20}}}
+		stored := make(chan contractsv1.Measurement, 10)
+		sink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			stored <- measurement
+			return nil
+		}
+		client, err := NewClient(source, 10*time.Millisecond, &sync.WaitGroup{}, sink)
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+
+		// act
+		go func() {
+			client.Run(ctx, apiv1.Config{})
+			close(finished)
+		}()
+		<-stored
+		<-stored
+		cancel()
+
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after cancellation")
+		}
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("ReturnsErrorForZeroInterval", func(t *testing.T) {
+
+		// act
+		_, err := NewClient(&fakeSource{}, 0, &sync.WaitGroup{})
+
+		assert.NotNil(t, err)
+	})
+}
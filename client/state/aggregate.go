@@ -0,0 +1,92 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+)
+
+// Aggregate combines the readings received in the window after start up to and including end; the history has to be
+// ordered oldest first and may contain older readings, the last of which is the value that was current when the window
+// started. Without readings in the window that value is used as if it got received at the start, except for count.
+func Aggregate(aggregation apiv1.Aggregation, history []Reading, start, end time.Time) (value float64, err error) {
+	var previous *Reading
+	window := []Reading{}
+	for i, r := range history {
+		if r.ReceivedTime.After(end) {
+			break
+		}
+		if r.ReceivedTime.After(start) {
+			window = append(window, r)
+			continue
+		}
+		previous = &history[i]
+	}
+
+	if aggregation == apiv1.AggregationCount {
+		return float64(len(window)), nil
+	}
+
+	if len(window) == 0 {
+		if previous == nil {
+			return value, fmt.Errorf("No readings received before %v", end)
+		}
+		window = []Reading{{Value: previous.Value, ReceivedTime: start}}
+	}
+
+	switch aggregation {
+	case "", apiv1.AggregationLast:
+		return window[len(window)-1].Value, nil
+
+	case apiv1.AggregationMean:
+		return mean(window), nil
+
+	case apiv1.AggregationMin:
+		value = math.Inf(1)
+		for _, r := range window {
+			value = math.Min(value, r.Value)
+		}
+		return value, nil
+
+	case apiv1.AggregationMax:
+		value = math.Inf(-1)
+		for _, r := range window {
+			value = math.Max(value, r.Value)
+		}
+		return value, nil
+
+	case apiv1.AggregationTimeWeightedMean:
+		// the value that was current at the start holds until the first reading in the window
+		if previous != nil && window[0].ReceivedTime.After(start) {
+			window = append([]Reading{{Value: previous.Value, ReceivedTime: start}}, window...)
+		}
+
+		weightedSum, total := 0.0, 0.0
+		for i, r := range window {
+			until := end
+			if i+1 < len(window) {
+				until = window[i+1].ReceivedTime
+			}
+			weight := until.Sub(r.ReceivedTime).Seconds()
+			weightedSum += r.Value * weight
+			total += weight
+		}
+		if total == 0 {
+			// all readings arrived at the end of the window
+			return mean(window), nil
+		}
+		return weightedSum / total, nil
+	}
+
+	return value, fmt.Errorf("Unknown aggregation %v", aggregation)
+}
+
+func mean(readings []Reading) float64 {
+	sum := 0.0
+	for _, r := range readings {
+		sum += r.Value
+	}
+	return sum / float64(len(readings))
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+
+	start := time.Date(2020, time.October, 11, 22, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Minute)
+	history := []Reading{
+		{Value: 18, ReceivedTime: start.Add(-5 * time.Minute)},
+		{Value: 20, ReceivedTime: start.Add(2 * time.Minute)},
+		{Value: 21, ReceivedTime: start.Add(3 * time.Minute)},
+		{Value: 22, ReceivedTime: start.Add(4 * time.Minute)},
+		{Value: 25, ReceivedTime: end.Add(time.Minute)},
+	}
+
+	t.Run("CombinesReadingsInWindow", func(t *testing.T) {
+
+		for aggregation, expected := range map[apiv1.Aggregation]float64{
+			apiv1.AggregationLast:  22,
+			apiv1.AggregationMean:  21,
+			apiv1.AggregationMin:   20,
+			apiv1.AggregationMax:   22,
+			apiv1.AggregationCount: 3,
+			// 18 for 2 minutes, 20 and 21 for 1 minute each and 22 for 6 minutes
+			apiv1.AggregationTimeWeightedMean: 20.9,
+		} {
+			// act
+			value, err := Aggregate(aggregation, history, start, end)
+
+			assert.Nil(t, err, string(aggregation))
+			assert.InDelta(t, expected, value, 0.0001, string(aggregation))
+		}
+	})
+
+	t.Run("UsesCurrentValueAtStartWithoutReadingsInWindow", func(t *testing.T) {
+
+		// act
+		value, err := Aggregate(apiv1.AggregationMean, history[:1], start, end)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 18.0, value)
+
+		count, err := Aggregate(apiv1.AggregationCount, history[:1], start, end)
+		assert.Nil(t, err)
+		assert.Equal(t, 0.0, count)
+	})
+
+	t.Run("ReturnsErrorWithoutReadings", func(t *testing.T) {
+
+		// act
+		_, err := Aggregate(apiv1.AggregationMean, history[4:], start, end)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForUnknownAggregation", func(t *testing.T) {
+
+		// act
+		_, err := Aggregate("median", history, start, end)
+
+		assert.NotNil(t, err)
+	})
+}
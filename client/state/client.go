@@ -0,0 +1,252 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
+)
+
+// Client is the interface for the in-memory model of the heating system, which keeps the latest decoded value of every
+// device, zone and value type together with a bounded history
+type Client interface {
+	Set(key Key, value float64, receivedTime time.Time)
+	Remove(key Key)
+	Get(key Key) (reading Reading, ok bool)
+	Latest(address protocol.Address, zoneIndex int, valueType apiv1.ValueType) (key Key, reading Reading, ok bool)
+	History(key Key, since time.Time) []Reading
+	ZoneHistory(address protocol.Address, zoneIndex int, valueType apiv1.ValueType, since time.Time) []Reading
+	Keys() []Key
+	Handler() http.Handler
+}
+
+// Key identifies a decoded value by the address of the device that sent it, the zone it applies to and its type
+type Key struct {
+	Address   protocol.Address `json:"address"`
+	ZoneIndex int              `json:"zoneIndex"`
+	ValueType apiv1.ValueType  `json:"valueType"`
+}
+
+// Reading is a decoded value with the time it got received
+type Reading struct {
+	Value        float64   `json:"value"`
+	ReceivedTime time.Time `json:"receivedTime"`
+}
+
+// Attribute is the current value and history of a key as served by the handler
+type Attribute struct {
+	Key
+	// Current is nil when the device reported the value as unavailable
+	Current *Reading  `json:"current"`
+	History []Reading `json:"history"`
+}
+
+// NewClient returns new state.Client keeping up to historySize readings per key
+func NewClient(historySize int) (Client, error) {
+	if historySize <= 0 {
+		return nil, fmt.Errorf("Please set a history size larger than 0")
+	}
+
+	return &client{
+		historySize: historySize,
+		entries:     map[Key]*entry{},
+	}, nil
+}
+
+type client struct {
+	historySize int
+
+	mutex   sync.RWMutex
+	entries map[Key]*entry
+}
+
+// entry holds the current reading and a ring buffer with the history, where next is the position to write to
+type entry struct {
+	current *Reading
+	history []Reading
+	next    int
+}
+
+// Set stores the value as current value and adds it to the history
+func (c *client) Set(key Key, value float64, receivedTime time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &entry{}
+		c.entries[key] = e
+	}
+
+	reading := Reading{Value: value, ReceivedTime: receivedTime}
+	e.current = &reading
+
+	if len(e.history) < c.historySize {
+		e.history = append(e.history, reading)
+		return
+	}
+	e.history[e.next] = reading
+	e.next = (e.next + 1) % c.historySize
+}
+
+// Remove clears the current value, so it doesn't get reported anymore; the history is kept
+func (c *client) Remove(key Key) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.current = nil
+	}
+}
+
+// Get returns the current value of a key
+func (c *client) Get(key Key) (reading Reading, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.current == nil {
+		return reading, false
+	}
+
+	return *e.current, true
+}
+
+// Latest returns the most recently received current value of a device and value type with its key for the zone index,
+// or for any zone if the zone index is -1; zones broadcast in the same frame go to the lowest zone index
+func (c *client) Latest(address protocol.Address, zoneIndex int, valueType apiv1.ValueType) (key Key, reading Reading, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for k, e := range c.entries {
+		if k.Address != address || k.ValueType != valueType || (zoneIndex >= 0 && k.ZoneIndex != zoneIndex) || e.current == nil {
+			continue
+		}
+		newer := e.current.ReceivedTime.After(reading.ReceivedTime)
+		if !ok || newer || (e.current.ReceivedTime.Equal(reading.ReceivedTime) && k.ZoneIndex < key.ZoneIndex) {
+			key, reading, ok = k, *e.current, true
+		}
+	}
+
+	return key, reading, ok
+}
+
+// History returns the readings of a key received after since, oldest first
+func (c *client) History(key Key, since time.Time) []Reading {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	history := []Reading{}
+	for _, r := range e.ordered() {
+		if r.ReceivedTime.After(since) {
+			history = append(history, r)
+		}
+	}
+
+	return history
+}
+
+// ZoneHistory returns the readings of a device and value type received after since for the zone index, or for all zones
+// if the zone index is -1, oldest first; like History it includes the readings of keys whose current value got removed
+func (c *client) ZoneHistory(address protocol.Address, zoneIndex int, valueType apiv1.ValueType, since time.Time) []Reading {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	history := []Reading{}
+	for k, e := range c.entries {
+		if k.Address != address || k.ValueType != valueType || (zoneIndex >= 0 && k.ZoneIndex != zoneIndex) {
+			continue
+		}
+		for _, r := range e.ordered() {
+			if r.ReceivedTime.After(since) {
+				history = append(history, r)
+			}
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].ReceivedTime.Before(history[j].ReceivedTime)
+	})
+
+	return history
+}
+
+// Keys returns the keys that have a current value, ordered by address, zone index and value type
+func (c *client) Keys() []Key {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	keys := []Key{}
+	for k, e := range c.entries {
+		if e.current != nil {
+			keys = append(keys, k)
+		}
+	}
+	sortKeys(keys)
+
+	return keys
+}
+
+// Handler serves all attributes with their history as json
+func (c *client) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(c.attributes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+func (c *client) attributes() []Attribute {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	keys := []Key{}
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+
+	attributes := []Attribute{}
+	for _, k := range keys {
+		e := c.entries[k]
+		attribute := Attribute{Key: k, History: e.ordered()}
+		if e.current != nil {
+			current := *e.current
+			attribute.Current = &current
+		}
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes
+}
+
+// ordered returns a copy of the history, oldest first
+func (e *entry) ordered() []Reading {
+	return append(append([]Reading{}, e.history[e.next:]...), e.history[:e.next]...)
+}
+
+func sortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Address != keys[j].Address {
+			return keys[i].Address < keys[j].Address
+		}
+		if keys[i].ZoneIndex != keys[j].ZoneIndex {
+			return keys[i].ZoneIndex < keys[j].ZoneIndex
+		}
+		return keys[i].ValueType < keys[j].ValueType
+	})
+}
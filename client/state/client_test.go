@@ -0,0 +1,179 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	t.Run("ReturnsErrorForEmptyHistory", func(t *testing.T) {
+
+		// act
+		_, err := NewClient(0)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGet(t *testing.T) {
+	t.Run("ReturnsLastValue", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		key := Key{Address: "34:092243", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.Set(key, 20, receivedTime)
+		c.Set(key, 20.5, receivedTime.Add(time.Minute))
+
+		// act
+		reading, ok := c.Get(key)
+
+		assert.True(t, ok)
+		assert.Equal(t, Reading{Value: 20.5, ReceivedTime: receivedTime.Add(time.Minute)}, reading)
+	})
+
+	t.Run("ReturnsNothingAfterRemove", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		key := Key{Address: "34:092243", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}
+		c.Set(key, 20, time.Now())
+		c.Remove(key)
+
+		// act
+		_, ok := c.Get(key)
+
+		assert.False(t, ok)
+		assert.Equal(t, []Key{}, c.Keys())
+	})
+}
+
+func TestLatest(t *testing.T) {
+	t.Run("ReturnsMostRecentValueOfAnyZone", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.Set(Key{Address: "01:145038", ZoneIndex: 1, ValueType: apiv1.ValueTypeTemperature}, 21, receivedTime.Add(time.Minute))
+		c.Set(Key{Address: "01:145038", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}, 20, receivedTime)
+		c.Set(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint}, 19, receivedTime.Add(time.Hour))
+
+		// act
+		anyZoneKey, anyZone, anyZoneOK := c.Latest("01:145038", -1, apiv1.ValueTypeTemperature)
+		_, zone, zoneOK := c.Latest("01:145038", 0, apiv1.ValueTypeTemperature)
+
+		assert.True(t, anyZoneOK)
+		assert.True(t, zoneOK)
+		assert.Equal(t, 21.0, anyZone.Value)
+		assert.Equal(t, 1, anyZoneKey.ZoneIndex)
+		assert.Equal(t, 20.0, zone.Value)
+	})
+
+	t.Run("ReturnsLowestZoneOfValuesReceivedAtTheSameTime", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		for _, zoneIndex := range []int{3, 1, 2} {
+			c.Set(Key{Address: "01:145038", ZoneIndex: zoneIndex, ValueType: apiv1.ValueTypeSetpoint}, float64(18+zoneIndex), receivedTime)
+		}
+
+		// act
+		key, reading, ok := c.Latest("01:145038", -1, apiv1.ValueTypeSetpoint)
+
+		assert.True(t, ok)
+		assert.Equal(t, 1, key.ZoneIndex)
+		assert.Equal(t, 19.0, reading.Value)
+	})
+}
+
+func TestHistory(t *testing.T) {
+	t.Run("ReturnsBoundedHistoryOldestFirst", func(t *testing.T) {
+
+		c, _ := NewClient(3)
+		key := Key{Address: "34:092243", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			c.Set(key, float64(20+i), receivedTime.Add(time.Duration(i)*time.Minute))
+		}
+
+		// act
+		history := c.History(key, time.Time{})
+
+		if assert.Equal(t, 3, len(history)) {
+			assert.Equal(t, 22.0, history[0].Value)
+			assert.Equal(t, 23.0, history[1].Value)
+			assert.Equal(t, 24.0, history[2].Value)
+		}
+	})
+
+	t.Run("ReturnsReadingsSinceTimeAndKeepsThemAfterRemove", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		key := Key{Address: "34:092243", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.Set(key, 20, receivedTime)
+		c.Set(key, 21, receivedTime.Add(10*time.Minute))
+		c.Remove(key)
+
+		// act
+		history := c.History(key, receivedTime.Add(5*time.Minute))
+
+		assert.Equal(t, []Reading{{Value: 21, ReceivedTime: receivedTime.Add(10 * time.Minute)}}, history)
+	})
+}
+
+func TestZoneHistory(t *testing.T) {
+	t.Run("ReturnsReadingsOfAllZonesOldestFirstIncludingRemovedKeys", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.Set(Key{Address: "01:145038", ZoneIndex: 1, ValueType: apiv1.ValueTypeSetpoint}, 19, receivedTime.Add(time.Minute))
+		c.Set(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint}, 20, receivedTime)
+		c.Set(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint}, 21, receivedTime.Add(2*time.Minute))
+		c.Set(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeTemperature}, 22, receivedTime)
+		c.Remove(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint})
+
+		// act
+		history := c.ZoneHistory("01:145038", -1, apiv1.ValueTypeSetpoint, time.Time{})
+
+		assert.Equal(t, []Reading{
+			{Value: 20, ReceivedTime: receivedTime},
+			{Value: 19, ReceivedTime: receivedTime.Add(time.Minute)},
+			{Value: 21, ReceivedTime: receivedTime.Add(2 * time.Minute)},
+		}, history)
+
+		history = c.ZoneHistory("01:145038", 2, apiv1.ValueTypeSetpoint, receivedTime)
+		assert.Equal(t, []Reading{{Value: 21, ReceivedTime: receivedTime.Add(2 * time.Minute)}}, history)
+	})
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("ReturnsAttributesAsJSON", func(t *testing.T) {
+
+		c, _ := NewClient(10)
+		receivedTime := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.UTC)
+		c.Set(Key{Address: "34:092243", ZoneIndex: 0, ValueType: apiv1.ValueTypeTemperature}, 20.5, receivedTime)
+		c.Set(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint}, 19, receivedTime)
+		c.Remove(Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint})
+		recorder := httptest.NewRecorder()
+
+		// act
+		c.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/state", nil))
+
+		assert.Equal(t, 200, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		var attributes []Attribute
+		err := json.Unmarshal(recorder.Body.Bytes(), &attributes)
+		assert.Nil(t, err)
+		if assert.Equal(t, 2, len(attributes)) {
+			assert.Equal(t, Key{Address: "01:145038", ZoneIndex: 2, ValueType: apiv1.ValueTypeSetpoint}, attributes[0].Key)
+			assert.Nil(t, attributes[0].Current)
+			assert.Equal(t, 1, len(attributes[0].History))
+			if assert.NotNil(t, attributes[1].Current) {
+				assert.Equal(t, 20.5, attributes[1].Current.Value)
+			}
+		}
+	})
+}
@@ -8,13 +8,17 @@ require (
 	github.com/alecthomas/kingpin v2.2.6+incompatible
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20190910110746-680d30ca3117 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/estafette/estafette-foundation v0.0.61
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/google/uuid v1.1.1
 	github.com/jacobsa/go-serial v0.0.0-20180131005756-15cf729a72d4
 	github.com/kr/pretty v0.2.0 // indirect
+	github.com/prometheus/client_golang v0.9.2
 	github.com/rs/zerolog v1.17.2
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
+	google.golang.org/api v0.8.0
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v2 v2.2.4
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
@@ -2,11 +2,28 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
 	"runtime"
+	"sync"
+	"time"
 
+	contractsv1 "github.com/JorritSalverda/jarvis-contracts-golang/contracts/v1"
+	apiv1 "github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/api/v1"
 	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/antenna"
 	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/bigquery"
 	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/config"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/discovery"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/health"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/metrics"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/mqtt"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/pulse"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/replay"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/scheduler"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/client/state"
+	"github.com/JorritSalverda/jarvis-uponor-smatrix-exporter/protocol"
 	"github.com/alecthomas/kingpin"
 	foundation "github.com/estafette/estafette-foundation"
 	"github.com/rs/zerolog/log"
@@ -24,22 +41,77 @@ var (
 
 	// application specific config
 	antennaUSBDevicePath = kingpin.Flag("antenna-usb-device-path", "Path to usb device connecting 868MHz RF antenna.").Default("/dev/ttyUSB0").OverrideDefaultFromEnvar("ANTENNA_USB_DEVICE_PATH").String()
+	antennaURL           = kingpin.Flag("antenna-url", "Url of the 868MHz RF antenna like serial:///dev/ttyUSB0, tcp://host:port or file://capture.log; overrides the usb device path.").Envar("ANTENNA_URL").String()
+
+	source            = kingpin.Flag("source", "Where to get the zone values from, the 868MHz RF antenna or a Smatrix Pulse gateway.").Default("antenna").OverrideDefaultFromEnvar("SOURCE").Enum("antenna", "pulse")
+	pulseURL          = kingpin.Flag("pulse-url", "Url of the Smatrix Pulse R-208 gateway like http://192.168.1.10").Envar("PULSE_URL").String()
+	pulsePollInterval = kingpin.Flag("pulse-poll-interval", "Interval at which the Smatrix Pulse gateway gets polled.").Default("1m").OverrideDefaultFromEnvar("PULSE_POLL_INTERVAL").Duration()
+
+	captureEnable     = kingpin.Flag("capture-enable", "Toggle to enable writing every received line to a capture file").Default("false").OverrideDefaultFromEnvar("CAPTURE_ENABLE").Bool()
+	captureFilePath   = kingpin.Flag("capture-file-path", "Path to the capture file, rotated files get a .1, .2, etc suffix").Default("/captures/capture.jsonl").OverrideDefaultFromEnvar("CAPTURE_FILE_PATH").String()
+	captureMaxSizeMB  = kingpin.Flag("capture-max-size-mb", "Size in megabytes at which the capture file gets rotated").Default("10").OverrideDefaultFromEnvar("CAPTURE_MAX_SIZE_MB").Int64()
+	captureMaxBackups = kingpin.Flag("capture-max-backups", "Number of rotated capture files to keep").Default("5").OverrideDefaultFromEnvar("CAPTURE_MAX_BACKUPS").Int()
+
+	httpPort = kingpin.Flag("http-port", "Port to serve the /metrics, /healthz, /readyz and /state endpoints on").Default("9101").OverrideDefaultFromEnvar("HTTP_PORT").Int()
+
+	healthMaxFrameAge = kingpin.Flag("health-max-frame-age", "Maximum time without a valid frame from the antenna before /healthz and /readyz fail.").Default("10m").OverrideDefaultFromEnvar("HEALTH_MAX_FRAME_AGE").Duration()
+	healthMaxStoreAge = kingpin.Flag("health-max-store-age", "Maximum time without successfully storing a measurement before /readyz fails.").Default("30m").OverrideDefaultFromEnvar("HEALTH_MAX_STORE_AGE").Duration()
+
+	measurementInterval = kingpin.Flag("measurement-interval", "Interval at which a measurement with the latest received values gets stored.").Default("5m").OverrideDefaultFromEnvar("MEASUREMENT_INTERVAL").Duration()
 
 	bigqueryEnable    = kingpin.Flag("bigquery-enable", "Toggle to enable or disable bigquery integration").Default("true").OverrideDefaultFromEnvar("BQ_ENABLE").Bool()
 	bigqueryInit      = kingpin.Flag("bigquery-init", "Toggle to enable bigquery table initialization").Default("true").OverrideDefaultFromEnvar("BQ_INIT").Bool()
-	bigqueryProjectID = kingpin.Flag("bigquery-project-id", "Google Cloud project id that contains the BigQuery dataset").Envar("BQ_PROJECT_ID").Required().String()
-	bigqueryDataset   = kingpin.Flag("bigquery-dataset", "Name of the BigQuery dataset").Envar("BQ_DATASET").Required().String()
-	bigqueryTable     = kingpin.Flag("bigquery-table", "Name of the BigQuery table").Envar("BQ_TABLE").Required().String()
+	bigqueryProjectID = kingpin.Flag("bigquery-project-id", "Google Cloud project id that contains the BigQuery dataset").Envar("BQ_PROJECT_ID").String()
+	bigqueryDataset   = kingpin.Flag("bigquery-dataset", "Name of the BigQuery dataset").Envar("BQ_DATASET").String()
+	bigqueryTable     = kingpin.Flag("bigquery-table", "Name of the BigQuery table").Envar("BQ_TABLE").String()
+
+	bigqueryBatchSize     = kingpin.Flag("bigquery-batch-size", "Number of measurements to insert into BigQuery at once").Default("10").OverrideDefaultFromEnvar("BQ_BATCH_SIZE").Int()
+	bigqueryFlushInterval = kingpin.Flag("bigquery-flush-interval", "Interval at which buffered measurements get inserted into BigQuery").Default("1m").OverrideDefaultFromEnvar("BQ_FLUSH_INTERVAL").Duration()
+	bigquerySpoolPath     = kingpin.Flag("bigquery-spool-path", "Path to the file keeping measurements that couldn't be inserted into BigQuery").Default("/spool/bigquery.jsonl").OverrideDefaultFromEnvar("BQ_SPOOL_PATH").String()
+	bigquerySpoolMax      = kingpin.Flag("bigquery-spool-max-measurements", "Maximum number of measurements to keep in the spool file; the oldest ones get dropped beyond it").Default("10080").OverrideDefaultFromEnvar("BQ_SPOOL_MAX_MEASUREMENTS").Int()
+
+	mqttEnable          = kingpin.Flag("mqtt-enable", "Toggle to enable publishing values to an mqtt broker").Default("false").OverrideDefaultFromEnvar("MQTT_ENABLE").Bool()
+	mqttBrokerURL       = kingpin.Flag("mqtt-broker-url", "Url of the mqtt broker like tcp://localhost:1883").Default("tcp://localhost:1883").OverrideDefaultFromEnvar("MQTT_BROKER_URL").String()
+	mqttClientID        = kingpin.Flag("mqtt-client-id", "Client id to connect to the mqtt broker with").Default("jarvis-uponor-smatrix-exporter").OverrideDefaultFromEnvar("MQTT_CLIENT_ID").String()
+	mqttUsername        = kingpin.Flag("mqtt-username", "Username for the mqtt broker").Envar("MQTT_USERNAME").String()
+	mqttPassword        = kingpin.Flag("mqtt-password", "Password for the mqtt broker").Envar("MQTT_PASSWORD").String()
+	mqttTopicPrefix     = kingpin.Flag("mqtt-topic-prefix", "Prefix for the topics values get published to").Default("jarvis/uponor").OverrideDefaultFromEnvar("MQTT_TOPIC_PREFIX").String()
+	mqttDiscoveryPrefix = kingpin.Flag("mqtt-discovery-prefix", "Prefix for home assistant mqtt discovery topics").Default("homeassistant").OverrideDefaultFromEnvar("MQTT_DISCOVERY_PREFIX").String()
 
 	configPath                   = kingpin.Flag("config-path", "Path to the config.yaml file").Default("/configs/config.yaml").OverrideDefaultFromEnvar("CONFIG_PATH").String()
 	measurementFilePath          = kingpin.Flag("state-file-path", "Path to file with state.").Default("/configs/last-measurement.json").OverrideDefaultFromEnvar("MEASUREMENT_FILE_PATH").String()
 	measurementFileConfigMapName = kingpin.Flag("state-file-configmap-name", "Name of the configmap with state file.").Default("jarvis-uponor-smatrix-exporter").OverrideDefaultFromEnvar("MEASUREMENT_FILE_CONFIG_MAP_NAME").String()
+
+	// commands
+	runCommand = kingpin.Command("run", "Listen to the antenna and store measurements periodically.").Default()
+
+	replayCommand         = kingpin.Command("replay", "Replay a capture file through the decoding and measurement pipeline and store the resulting measurements.")
+	replayCaptureFilePath = replayCommand.Arg("capture-file-path", "Path to the capture file to replay.").Required().String()
+	replaySpeed           = replayCommand.Flag("replay-speed", "Speed relative to the original timing, for example 60 to replay an hour in a minute; 0 replays as fast as possible.").Default("0").Float64()
+	replayPrint           = replayCommand.Flag("replay-print", "Toggle to print every measurement as json to stdout.").Default("false").Bool()
+
+	discoverCommand  = kingpin.Command("discover", "Listen to the antenna for a while and print a starter config.yaml for all received devices.")
+	discoverDuration = discoverCommand.Flag("discover-duration", "How long to listen for devices; most devices broadcast their values at least every 15 minutes.").Default("20m").Duration()
+	discoverLocation = discoverCommand.Flag("discover-location", "Location to put in the generated config.").Default("My Home").String()
+	discoverOutput   = discoverCommand.Flag("discover-output-path", "Path to write the generated config to; prints it to stdout if empty, mixed with the logs.").String()
+
+	setCommand      = kingpin.Command("set", "Change the heating system through the antenna and wait until the controller confirms it.")
+	setControllerID = setCommand.Flag("controller-id", "Address of the controller like 01:145038.").Required().String()
+	setTimeout      = setCommand.Flag("set-timeout", "How long to wait for the controller to confirm the change.").Default("1m").Duration()
+
+	setSetpointCommand   = setCommand.Command("setpoint", "Set the setpoint of a zone.")
+	setSetpointZoneIndex = setSetpointCommand.Arg("zone-index", "Zone index of the controller, starting at 0.").Required().Int()
+	setSetpointValue     = setSetpointCommand.Arg("setpoint", "Setpoint in °C.").Required().Float64()
+
+	setModeCommand = setCommand.Command("mode", "Set the system mode of the controller.")
+	setModeName    = setModeCommand.Arg("mode", "One of auto, heatOff, eco, away, dayOff, dayOffEco, autoWithReset or custom.").Required().String()
+	setModeFor     = setModeCommand.Flag("mode-duration", "How long the mode lasts; it's permanent if not set.").Duration()
 )
 
 func main() {
 
 	// parse command line parameters
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	// init log format from envvar ESTAFETTE_LOG_FORMAT
 	foundation.InitLoggingFromEnv(foundation.NewApplicationInfo(appgroup, app, version, branch, revision, buildDate))
@@ -49,6 +121,22 @@ func main() {
 	// create context to cancel commands on sigterm
 	ctx := foundation.InitCancellationContext(context.Background())
 
+	// discovery helps creating the config, so it runs without one
+	if command == discoverCommand.FullCommand() {
+		runDiscover(ctx)
+		return
+	}
+
+	// changing a setting is a one-off action that needs neither config nor bigquery
+	if command == setSetpointCommand.FullCommand() || command == setModeCommand.FullCommand() {
+		runSet(ctx, command)
+		return
+	}
+
+	if *bigqueryEnable && (*bigqueryProjectID == "" || *bigqueryDataset == "" || *bigqueryTable == "") {
+		log.Fatal().Msg("Please set the bigquery project id, dataset and table or disable bigquery")
+	}
+
 	configClient, err := config.NewClient(ctx)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed creating config.Client")
@@ -90,29 +178,362 @@ func main() {
 	// get previous measurement
 	// measurementMap := readLastMeasurementFromMeasurementFile()
 
-	done := make(chan struct{})
-	antennaClient, err := antenna.NewClient(*antennaUSBDevicePath, waitGroup, done)
+	// buffer measurements and insert them in batches, flushing what's left on shutdown
+	bigqueryWriter, err := bigquery.NewWriter(bigqueryClient, *bigqueryDataset, *bigqueryTable, *bigqueryBatchSize, *bigqueryFlushInterval, *bigquerySpoolPath, *bigquerySpoolMax)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating bigquery writer")
+	}
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		bigqueryWriter.Run(ctx)
+	}()
+
+	bigquerySink := func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+		return bigqueryWriter.Write(measurement)
+	}
+
+	switch command {
+	case replayCommand.FullCommand():
+		runReplay(ctx, waitGroup, config, bigquerySink)
+
+		// a replay ends without a shutdown signal, so flush the remaining measurements right away
+		err = bigqueryWriter.Flush(context.Background())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed flushing replayed measurements to bigquery")
+		}
+	case runCommand.FullCommand():
+		runListener(ctx, gracefulShutdown, waitGroup, config, bigquerySink)
+	}
+}
+
+// listenerSource provides the live values of either the antenna or the Smatrix Pulse gateway
+type listenerSource interface {
+	Listen(ctx context.Context) (err error)
+	GetStatistics() antenna.Statistics
+	GetDevices() []antenna.Device
+	GetMeasurement(config apiv1.Config) (measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample, err error)
+	GetSample(config apiv1.Config, sampleConfig apiv1.ConfigSample) (sample contractsv1.Sample, err error)
+}
+
+func runListener(ctx context.Context, gracefulShutdown chan os.Signal, waitGroup *sync.WaitGroup, config apiv1.Config, sinks ...scheduler.Sink) {
+
+	var listener listenerSource
+	var stateClient state.Client
+	if *source == "pulse" {
+		// the gateway is polled for its current values only, so there are no readings to aggregate
+		for _, sc := range config.SampleConfigs {
+			if sc.Aggregation != apiv1.AggregationLast {
+				log.Fatal().Msgf("Sample %v of thermostat %v uses aggregation %v, but the pulse source only supports %v", sc.SampleName, sc.ThermostatID, sc.Aggregation, apiv1.AggregationLast)
+			}
+		}
+		listener = newPulseClient()
+	} else {
+		antennaClient := newAntennaClient(config)
+		listener = antennaClient
+		stateClient = antennaClient.State()
+	}
+
+	// keep listening while measurements get stored periodically
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		err := listener.Listen(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Listener failed")
+		}
+	}()
+
+	metricsClient, err := metrics.NewClient(listener, config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating metrics client")
+	}
+
+	// publish to mqtt next to the other sinks; replays don't, because they would overwrite the retained live values
+	if *mqttEnable {
+		mqttClient := newMQTTClient(config)
+		defer mqttClient.Close()
+
+		sinks = append(sinks, mqttClient.PublishMeasurement)
+	}
+
+	schedulerClient, err := scheduler.NewClient(listener, *measurementInterval, waitGroup, sinks...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating scheduler client")
+	}
+
+	healthClient, err := health.NewClient(listener, schedulerClient, *healthMaxFrameAge, *healthMaxStoreAge)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating health client")
+	}
+
+	serveMux := http.NewServeMux()
+	serveMux.Handle("/metrics", metricsClient.Handler())
+	serveMux.Handle("/healthz", healthClient.LivenessHandler())
+	serveMux.Handle("/readyz", healthClient.ReadinessHandler())
+	// the gateway keeps its own state, so only the antenna has a state store to serve
+	if stateClient != nil {
+		serveMux.Handle("/state", stateClient.Handler())
+	}
+	go serveHTTP(ctx, serveMux)
+
+	go schedulerClient.Run(ctx, config)
+
+	// writeMeasurementToConfigmap(kubeClientset, measurement)
+
+	foundation.HandleGracefulShutdown(gracefulShutdown, waitGroup)
+}
+
+func newPulseClient() pulse.Client {
+
+	pulseClient, err := pulse.NewClient(*pulseURL, *pulsePollInterval)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating pulse client")
+	}
+
+	return pulseClient
+}
+
+func newAntennaClient(config apiv1.Config) antenna.Client {
+
+	transport := newTransport()
+
+	var recorder antenna.Recorder
+	var err error
+	if *captureEnable {
+		recorder, err = antenna.NewRecorder(*captureFilePath, *captureMaxSizeMB*1024*1024, *captureMaxBackups)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating capture recorder")
+		}
+	}
+
+	filter, err := antenna.NewDeviceFilter(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating device filter")
+	}
+
+	antennaClient, err := antenna.NewClient(transport, recorder, filter)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed creating antenna client")
 	}
 
 	go func() {
-		measurement, err := antennaClient.GetMeasurement(config)
+		for status := range antennaClient.Status() {
+			if status.Connected {
+				log.Info().Msgf("Connected to antenna on %v", transport)
+			} else {
+				log.Warn().Err(status.Err).Msgf("Disconnected from antenna on %v", transport)
+			}
+		}
+	}()
+
+	return antennaClient
+}
+
+func runDiscover(ctx context.Context) {
+
+	// the device filter is part of the config, which discovery runs without
+	antennaClient, err := antenna.NewClient(newTransport(), nil, nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating antenna client")
+	}
+
+	discoveryClient, err := discovery.NewClient(antennaClient)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating discovery client")
+	}
+
+	go func() {
+		for status := range antennaClient.Status() {
+			if !status.Connected {
+				log.Warn().Err(status.Err).Msg("Disconnected from antenna")
+			}
+		}
+	}()
+
+	log.Info().Msgf("Listening for devices for %v...", *discoverDuration)
+
+	listenCtx, cancel := context.WithTimeout(ctx, *discoverDuration)
+	defer cancel()
+
+	err = antennaClient.Listen(listenCtx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Antenna listener failed")
+	}
+
+	output := os.Stdout
+	if *discoverOutput != "" {
+		output, err = os.Create(*discoverOutput)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed getting measurement from Uponor Smatrix")
+			log.Fatal().Err(err).Msgf("Failed creating %v", *discoverOutput)
 		}
+		defer output.Close()
+	}
+
+	err = discoveryClient.WriteConfig(output, *discoverLocation)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed writing discovered config")
+	}
+
+	log.Info().Msgf("Discovered %v devices", len(antennaClient.GetDevices()))
+}
+
+func runSet(ctx context.Context, command string) {
 
-		// err = bigqueryClient.InsertMeasurement(*bigqueryDataset, *bigqueryTable, measurement)
-		// if err != nil {
-		// 	log.Fatal().Err(err).Msg("Failed inserting measurements into bigquery table")
-		// }
+	controller, err := protocol.ParseAddress(*setControllerID)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid controller id")
+	}
+
+	antennaClient, err := antenna.NewClient(newTransport(), nil, nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating antenna client")
+	}
 
-		// writeMeasurementToConfigmap(kubeClientset, measurement)
+	listenCtx, cancel := context.WithCancel(ctx)
+	listenerDone := make(chan struct{})
+	go func() {
+		defer close(listenerDone)
+		err := antennaClient.Listen(listenCtx)
+		if err != nil {
+			log.Error().Err(err).Msg("Antenna listener failed")
+		}
+	}()
 
-		log.Info().Msgf("Stored %v samples, exiting...", len(measurement.Samples))
+	go func() {
+		for status := range antennaClient.Status() {
+			if !status.Connected {
+				log.Warn().Err(status.Err).Msg("Disconnected from antenna")
+			}
+		}
 	}()
 
-	foundation.HandleGracefulShutdown(gracefulShutdown, waitGroup, func() { close(done) })
+	setCtx, setCancel := context.WithTimeout(ctx, *setTimeout)
+	defer setCancel()
+
+	switch command {
+	case setSetpointCommand.FullCommand():
+		err = antennaClient.SetZoneSetpoint(setCtx, controller, *setSetpointZoneIndex, *setSetpointValue)
+		if err == nil {
+			log.Info().Msgf("Controller %v confirmed setpoint %v for zone %02X", controller, *setSetpointValue, *setSetpointZoneIndex)
+		}
+
+	case setModeCommand.FullCommand():
+		var mode protocol.SystemMode
+		mode, err = protocol.ParseSystemMode(*setModeName)
+		if err != nil {
+			break
+		}
+		var until *time.Time
+		if *setModeFor > 0 {
+			modeUntil := time.Now().Add(*setModeFor)
+			until = &modeUntil
+		}
+		err = antennaClient.SetSystemMode(setCtx, controller, mode, until)
+		if err == nil {
+			log.Info().Msgf("Controller %v confirmed system mode %v", controller, mode)
+		}
+	}
+
+	cancel()
+	<-listenerDone
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed changing the heating system")
+	}
+}
+
+func newTransport() antenna.Transport {
+
+	transportURL := *antennaUSBDevicePath
+	if *antennaURL != "" {
+		transportURL = *antennaURL
+	}
+	transport, err := antenna.NewTransport(transportURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating antenna transport")
+	}
+
+	return transport
+}
+
+func newMQTTClient(config apiv1.Config) mqtt.Client {
+
+	publisher, err := mqtt.NewPublisher(*mqttBrokerURL, *mqttClientID, *mqttUsername, *mqttPassword, mqtt.AvailabilityTopic(*mqttTopicPrefix, config.Location))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating mqtt publisher")
+	}
+
+	mqttClient, err := mqtt.NewClient(publisher, config, *mqttTopicPrefix, *mqttDiscoveryPrefix)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating mqtt client")
+	}
+
+	err = mqttClient.PublishDiscovery()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed publishing home assistant discovery")
+	}
+
+	return mqttClient
+}
+
+func serveHTTP(ctx context.Context, handler http.Handler) {
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%v", *httpPort),
+		Handler: handler,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Info().Msgf("Serving http on port %v...", *httpPort)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal().Err(err).Msg("Starting http listener failed")
+	}
+}
+
+func runReplay(ctx context.Context, waitGroup *sync.WaitGroup, config apiv1.Config, sinks ...scheduler.Sink) {
+
+	if *replayPrint {
+		sinks = append(sinks, func(measurement contractsv1.Measurement, sampleConfigs []apiv1.ConfigSample) error {
+			data, err := json.Marshal(measurement)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		})
+	}
+
+	filter, err := antenna.NewDeviceFilter(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating device filter")
+	}
+
+	antennaClient, err := antenna.NewReplayClient(filter)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating antenna replay client")
+	}
+
+	schedulerClient, err := scheduler.NewClient(antennaClient, *measurementInterval, waitGroup, sinks...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating scheduler client")
+	}
+
+	replayClient, err := replay.NewClient(antennaClient, schedulerClient, *measurementInterval, *replaySpeed)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed creating replay client")
+	}
+
+	err = replayClient.Replay(ctx, *replayCaptureFilePath, config)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed replaying capture file %v", *replayCaptureFilePath)
+	}
 }
 
 // func readLastMeasurementFromMeasurementFile() (measurementMap map[string]float64) {
@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+const OpcodeBatteryState Opcode = "1060"
+
+// BatteryState is the battery of a wireless device as sent with opcode 1060
+type BatteryState struct {
+	ZoneIndex int
+	// Level is in percent; many devices only report whether their battery is low
+	Level          float64
+	LevelAvailable bool
+	Low            bool
+}
+
+// DecodeBatteryState decodes a 3 byte 1060 payload
+func DecodeBatteryState(frame *Frame) (state BatteryState, err error) {
+	if frame.Opcode != OpcodeBatteryState {
+		return state, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeBatteryState)
+	}
+	if len(frame.Payload) != 3 {
+		return state, fmt.Errorf("Payload of %v bytes for opcode %v is not 3 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	state.ZoneIndex = int(frame.Payload[0])
+	state.Level, state.LevelAvailable = decodePercentage(frame.Payload[1])
+	// the last byte is 01 when the battery is fine and 00 when it's low
+	state.Low = frame.Payload[2] == 0x00
+
+	return state, nil
+}
@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBatteryState(t *testing.T) {
+	t.Run("ReturnsLevelAndLowFlag", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:056057 --:------ 04:056057 1060 003 002801")
+
+		// act
+		state, err := DecodeBatteryState(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, BatteryState{ZoneIndex: 0, Level: 20, LevelAvailable: true, Low: false}, state)
+	})
+
+	t.Run("ReturnsLowWithoutLevel", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 34:092243 --:------ 34:092243 1060 003 00FF00")
+
+		// act
+		state, err := DecodeBatteryState(frame)
+
+		assert.Nil(t, err)
+		assert.False(t, state.LevelAvailable)
+		assert.True(t, state.Low)
+	})
+
+	t.Run("ReturnsErrorForInvalidLength", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 34:092243 --:------ 34:092243 1060 002 00FF")
+
+		// act
+		_, err := DecodeBatteryState(frame)
+
+		assert.NotNil(t, err)
+	})
+}
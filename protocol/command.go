@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GatewayAddress is the source address for transmitted frames, which the evofw3 firmware replaces with the address of
+// the antenna
+const GatewayAddress Address = "18:000730"
+
+// NewFrame returns a frame to transmit from the antenna to a device
+func NewFrame(verb Verb, destination Address, opcode Opcode, payload []byte) *Frame {
+	frame := &Frame{
+		Verb:      verb,
+		Sequence:  NoSequence,
+		Addresses: [3]Address{GatewayAddress, destination, ""},
+		Opcode:    Opcode(strings.ToUpper(string(opcode))),
+		Length:    len(payload),
+		Payload:   payload,
+	}
+	frame.Raw = frame.Encode()
+
+	return frame
+}
+
+// Encode returns the frame as a line like 'RQ --- 18:000730 01:145038 --:------ 0418 003 000000' to write to the
+// antenna, which unlike received lines has no rssi
+func (f *Frame) Encode() string {
+	sequence := "---"
+	if f.Sequence != NoSequence {
+		sequence = fmt.Sprintf("%03d", f.Sequence)
+	}
+
+	return fmt.Sprintf("%2v %v %v %v %v %v %03d %X", f.Verb, sequence, f.Addresses[0], f.Addresses[1], f.Addresses[2], f.Opcode, len(f.Payload), f.Payload)
+}
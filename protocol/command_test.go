@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFrame(t *testing.T) {
+	t.Run("ReturnsRequestFromGateway", func(t *testing.T) {
+
+		// act
+		frame := NewFrame(VerbRequest, "01:145038", "0418", []byte{0x00, 0x00, 0x01})
+
+		assert.Equal(t, "RQ --- 18:000730 01:145038 --:------ 0418 003 000001", frame.Raw)
+		assert.Equal(t, Address("01:145038"), frame.Destination())
+	})
+
+	t.Run("PadsInformationVerb", func(t *testing.T) {
+
+		// act
+		frame := NewFrame(VerbInformation, "01:145038", "1f09", []byte{0xFF})
+
+		assert.Equal(t, " I --- 18:000730 01:145038 --:------ 1F09 001 FF", frame.Raw)
+	})
+}
+
+func TestEncode(t *testing.T) {
+	t.Run("RoundTripsWithParseFrame", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RP --- 01:145038 18:013393 --:------ 2309 003 0107D0")
+
+		// act
+		line := frame.Encode()
+
+		parsed, err := ParseFrame("045 " + line)
+		assert.Nil(t, err)
+		assert.Equal(t, frame, parsed)
+	})
+}
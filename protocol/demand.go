@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+const (
+	OpcodeRelayDemand   Opcode = "0008"
+	OpcodeHeatDemand    Opcode = "3150"
+	OpcodeActuatorState Opcode = "3EF0"
+)
+
+// percentageUnavailable is sent instead of a percentage when a device has no valid value
+const percentageUnavailable = 0xFF
+
+// HeatDemand is how hard a zone calls for heat as sent with opcode 3150
+type HeatDemand struct {
+	ZoneIndex int
+	// Demand is in percent
+	Demand    float64
+	Available bool
+}
+
+// RelayDemand is the demand sent to a relay or zone valve with opcode 0008
+type RelayDemand struct {
+	// ZoneIndex can also be a domain like FC for the boiler relay
+	ZoneIndex int
+	// Demand is in percent
+	Demand    float64
+	Available bool
+}
+
+// ActuatorState is the state of a relay or actuator as sent with opcode 3EF0
+type ActuatorState struct {
+	ZoneIndex int
+	// ModulationLevel is in percent, relays only report 0 or 100
+	ModulationLevel float64
+	Available       bool
+}
+
+// DecodeHeatDemands decodes a single zone or multi-zone 3150 payload
+func DecodeHeatDemands(frame *Frame) (demands []HeatDemand, err error) {
+	if frame.Opcode != OpcodeHeatDemand {
+		return nil, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeHeatDemand)
+	}
+	if len(frame.Payload) == 0 || len(frame.Payload)%2 != 0 {
+		return nil, fmt.Errorf("Payload of %v bytes for opcode %v is not a multiple of 2", len(frame.Payload), frame.Opcode)
+	}
+
+	for i := 0; i < len(frame.Payload); i += 2 {
+		demand, available := decodePercentage(frame.Payload[i+1])
+		demands = append(demands, HeatDemand{
+			ZoneIndex: int(frame.Payload[i]),
+			Demand:    demand,
+			Available: available,
+		})
+	}
+
+	return demands, nil
+}
+
+// DecodeRelayDemand decodes a 2 byte 0008 payload
+func DecodeRelayDemand(frame *Frame) (demand RelayDemand, err error) {
+	if frame.Opcode != OpcodeRelayDemand {
+		return demand, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeRelayDemand)
+	}
+	if len(frame.Payload) != 2 {
+		return demand, fmt.Errorf("Payload of %v bytes for opcode %v is not 2 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	demand.ZoneIndex = int(frame.Payload[0])
+	demand.Demand, demand.Available = decodePercentage(frame.Payload[1])
+
+	return demand, nil
+}
+
+// DecodeActuatorState decodes a 3EF0 payload; only the first 3 bytes are used, longer payloads from OpenTherm bridges carry
+// extra boiler details
+func DecodeActuatorState(frame *Frame) (state ActuatorState, err error) {
+	if frame.Opcode != OpcodeActuatorState {
+		return state, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeActuatorState)
+	}
+	if len(frame.Payload) < 3 {
+		return state, fmt.Errorf("Payload of %v bytes for opcode %v is shorter than 3 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	state.ZoneIndex = int(frame.Payload[0])
+	state.ModulationLevel, state.Available = decodePercentage(frame.Payload[1])
+
+	return state, nil
+}
+
+// decodePercentage converts a byte in half percents (0xC8 is 100%) into percent
+func decodePercentage(value byte) (percentage float64, available bool) {
+	if value == percentageUnavailable || value > 0xC8 {
+		return 0, false
+	}
+
+	return float64(value) / 2, true
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeHeatDemands(t *testing.T) {
+
+	t.Run("ReturnsDemandForSingleZone", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:189078 --:------ 01:145038 3150 002 0164")
+
+		// act
+		demands, err := DecodeHeatDemands(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []HeatDemand{{ZoneIndex: 1, Demand: 50, Available: true}}, demands)
+	})
+
+	t.Run("ReturnsDemandsForMultipleZones", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 02:001107 --:------ 02:001107 3150 006 00C8010002FF")
+
+		// act
+		demands, err := DecodeHeatDemands(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []HeatDemand{
+			{ZoneIndex: 0, Demand: 100, Available: true},
+			{ZoneIndex: 1, Demand: 0, Available: true},
+			{ZoneIndex: 2, Available: false},
+		}, demands)
+	})
+
+	t.Run("ReturnsErrorForOddPayload", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 02:001107 --:------ 02:001107 3150 003 00C801")
+
+		// act
+		_, err := DecodeHeatDemands(frame)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDecodeRelayDemand(t *testing.T) {
+
+	t.Run("ReturnsDemand", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 0008 002 FC32")
+
+		// act
+		demand, err := DecodeRelayDemand(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, RelayDemand{ZoneIndex: 0xFC, Demand: 25, Available: true}, demand)
+	})
+}
+
+func TestDecodeActuatorState(t *testing.T) {
+
+	t.Run("ReturnsStateForRelay", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 13:163733 --:------ 13:163733 3EF0 003 00C8FF")
+
+		// act
+		state, err := DecodeActuatorState(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, ActuatorState{ZoneIndex: 0, ModulationLevel: 100, Available: true}, state)
+	})
+
+	t.Run("ReturnsErrorForShortPayload", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RQ --- 01:145038 13:163733 --:------ 3EF0 001 00")
+
+		// act
+		_, err := DecodeActuatorState(frame)
+
+		assert.NotNil(t, err)
+	})
+}
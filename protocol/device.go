@@ -0,0 +1,32 @@
+package protocol
+
+// deviceTypeNames describes the known RAMSES-II device type prefixes
+var deviceTypeNames = map[string]string{
+	"01": "Controller",
+	"02": "Underfloor heating controller",
+	"03": "Thermostat",
+	"04": "Radiator valve",
+	"07": "Hot water sensor",
+	"10": "OpenTherm bridge",
+	"12": "Thermostat",
+	"13": "Relay",
+	"17": "Outdoor sensor",
+	"18": "Gateway",
+	"22": "Thermostat",
+	"23": "Programmer",
+	"30": "Gateway",
+	"32": "Ventilation unit",
+	"34": "Thermostat",
+	"37": "Ventilation unit",
+}
+
+// DeviceTypeName returns a description of the device type like Controller or Thermostat, or Unknown device
+func (a Address) DeviceTypeName() string {
+	if a.IsUponor() {
+		return "Uponor thermostat"
+	}
+	if name, ok := deviceTypeNames[a.DeviceType()]; ok {
+		return name
+	}
+	return "Unknown device"
+}
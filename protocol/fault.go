@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+const OpcodeFaultLog Opcode = "0418"
+
+// FaultState tells whether a fault log entry reports a fault or its restore
+type FaultState byte
+
+const (
+	FaultStateFault   FaultState = 0x00
+	FaultStateRestore FaultState = 0x40
+)
+
+func (s FaultState) String() string {
+	switch s {
+	case FaultStateFault:
+		return "fault"
+	case FaultStateRestore:
+		return "restore"
+	}
+	return fmt.Sprintf("unknown %02X", byte(s))
+}
+
+// FaultType is the kind of fault in a fault log entry
+type FaultType byte
+
+var faultTypeNames = map[FaultType]string{
+	0x01: "system fault",
+	0x03: "mains low",
+	0x04: "battery low",
+	0x05: "battery error",
+	0x06: "comms fault",
+	0x07: "sensor fault",
+	0x0A: "sensor error",
+}
+
+func (t FaultType) String() string {
+	if name, ok := faultTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown %02X", byte(t))
+}
+
+// FaultLogEntry is a single entry of the controller's fault log as sent with opcode 0418
+type FaultLogEntry struct {
+	// LogIndex is the position in the log, 0 is the most recent entry
+	LogIndex int
+	// Empty is true when the log has no entry at LogIndex; the other fields are not set then
+	Empty       bool
+	State       FaultState
+	Type        FaultType
+	ZoneIndex   int
+	DeviceClass byte
+	Timestamp   *time.Time
+	// Device is the address of the faulty device
+	Device Address
+}
+
+var emptyFaultTimestamp = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x7F}
+
+// DecodeFaultLogEntry decodes a 22 byte 0418 payload
+func DecodeFaultLogEntry(frame *Frame) (entry FaultLogEntry, err error) {
+	if frame.Opcode != OpcodeFaultLog {
+		return entry, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeFaultLog)
+	}
+	if len(frame.Payload) != 22 {
+		return entry, fmt.Errorf("Payload of %v bytes for opcode %v is not 22 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	p := frame.Payload
+	entry.LogIndex = int(p[2])
+
+	entry.Timestamp = decodePackedDateTime(p[9:15])
+	if entry.Timestamp == nil {
+		entry.Empty = true
+		return entry, nil
+	}
+
+	entry.State = FaultState(p[1])
+	entry.Type = FaultType(p[4])
+	entry.ZoneIndex = int(p[5])
+	entry.DeviceClass = p[6]
+	entry.Device = decodeDeviceID(p[19:22])
+
+	return entry, nil
+}
+
+// decodePackedDateTime decodes the 6 byte timestamp of fault log entries, which packs year, month, day, hour, minute
+// and second into bit fields; it returns nil for an empty timestamp
+func decodePackedDateTime(data []byte) *time.Time {
+	if bytes.Equal(data, emptyFaultTimestamp) {
+		return nil
+	}
+
+	var packed uint64
+	for _, b := range data {
+		packed = packed<<8 | uint64(b)
+	}
+
+	dateTime := time.Date(
+		2000+int(packed>>24&0x7F),
+		time.Month(packed>>36&0x0F),
+		int(packed>>31&0x1F),
+		int(packed>>19&0x1F),
+		int(packed>>13&0x3F),
+		int(packed>>7&0x3F),
+		0, time.Local)
+
+	return &dateTime
+}
+
+// decodeDeviceID decodes the 3 byte binary form of an address, with the device type in the upper 6 bits
+func decodeDeviceID(data []byte) Address {
+	id := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+	if id == 0 || id == 0xFFFFFF {
+		return ""
+	}
+	return Address(fmt.Sprintf("%02d:%06d", id>>18, id&0x3FFFF))
+}
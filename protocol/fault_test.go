@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFaultLogEntry(t *testing.T) {
+	t.Run("ReturnsEntry", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RP --- 01:145038 18:013393 --:------ 0418 022 000001B0040204000000A594B3C780FFFF700010DAF9")
+
+		// act
+		entry, err := DecodeFaultLogEntry(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, entry.LogIndex)
+		assert.False(t, entry.Empty)
+		assert.Equal(t, FaultStateFault, entry.State)
+		assert.Equal(t, FaultType(0x04), entry.Type)
+		assert.Equal(t, "battery low", entry.Type.String())
+		assert.Equal(t, 2, entry.ZoneIndex)
+		assert.Equal(t, byte(0x04), entry.DeviceClass)
+		assert.Equal(t, Address("04:056057"), entry.Device)
+		if assert.NotNil(t, entry.Timestamp) {
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 30, 15, 0, time.Local), *entry.Timestamp)
+		}
+	})
+
+	t.Run("ReturnsEmptyEntryForEmptyLog", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RP --- 01:145038 18:013393 --:------ 0418 022 000000B0000000000000000000007FFFFF7000000000")
+
+		// act
+		entry, err := DecodeFaultLogEntry(frame)
+
+		assert.Nil(t, err)
+		assert.True(t, entry.Empty)
+		assert.Equal(t, 0, entry.LogIndex)
+	})
+
+	t.Run("ReturnsErrorForInvalidLength", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RQ --- 18:013393 01:145038 --:------ 0418 003 000000")
+
+		// act
+		_, err := DecodeFaultLogEntry(frame)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,184 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFrame is wrapped by every error returned from ParseFrame
+var ErrInvalidFrame = errors.New("Invalid frame")
+
+// Verb is the RAMSES-II message verb
+type Verb string
+
+const (
+	VerbInformation Verb = "I"
+	VerbWrite       Verb = "W"
+	VerbRequest     Verb = "RQ"
+	VerbReply       Verb = "RP"
+)
+
+// Opcode is the 4 hex digit RAMSES-II command code, always in upper case
+type Opcode string
+
+// NoSequence is used as Frame.Sequence when the line carries --- instead of a sequence number
+const NoSequence = -1
+
+// Address is a RAMSES-II device address in the form 01:145038; an empty address is printed as --:------
+type Address string
+
+const emptyAddress = "--:------"
+
+var (
+	addressRegex = regexp.MustCompile(`^\d{2}:\d{6}$`)
+	opcodeRegex  = regexp.MustCompile(`^[0-9a-fA-F]{4}$`)
+	decimalRegex = regexp.MustCompile(`^\d{3}$`)
+
+	// markers the antenna firmware appends to lines it failed to decode; none of them can occur in a valid line, unlike a
+	// bare BAD or ERR that is also valid hex in a payload
+	faultMarkers = []string{"_ENC", "_BAD", "* ERR"}
+)
+
+// ParseAddress validates an address in the form 01:145038
+func ParseAddress(address string) (Address, error) {
+	if !addressRegex.MatchString(address) {
+		return "", fmt.Errorf("Address %q is not in the form 01:234567", address)
+	}
+	return Address(address), nil
+}
+
+// IsEmpty returns true for the --:------ placeholder address
+func (a Address) IsEmpty() bool {
+	return a == ""
+}
+
+// DeviceType returns the 2 digit device type prefix, for example 01 for a controller or 04 for a radiator valve
+func (a Address) DeviceType() string {
+	if len(a) < 2 {
+		return ""
+	}
+	return string(a[:2])
+}
+
+func (a Address) String() string {
+	if a.IsEmpty() {
+		return emptyAddress
+	}
+	return string(a)
+}
+
+// Frame is a single decoded line as received by the antenna
+type Frame struct {
+	Raw       string
+	RSSI      int
+	Verb      Verb
+	Sequence  int
+	Addresses [3]Address
+	Opcode    Opcode
+	Length    int
+	Payload   []byte
+}
+
+// Source returns the address of the device that sent the frame
+func (f *Frame) Source() Address {
+	if !f.Addresses[0].IsEmpty() {
+		return f.Addresses[0]
+	}
+	return f.Addresses[2]
+}
+
+// Destination returns the address the frame is sent to or an empty address for broadcasts
+func (f *Frame) Destination() Address {
+	if !f.Addresses[1].IsEmpty() {
+		return f.Addresses[1]
+	}
+	if f.Addresses[2] != f.Source() {
+		return f.Addresses[2]
+	}
+	return ""
+}
+
+// ParseFrame parses a line like '045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0' into a Frame
+func ParseFrame(line string) (frame *Frame, err error) {
+
+	line = strings.TrimRight(line, "\r\n")
+
+	for _, marker := range faultMarkers {
+		if strings.Contains(line, marker) {
+			return nil, fmt.Errorf("%w: line contains fault marker %v", ErrInvalidFrame, marker)
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 8 || len(fields) > 9 {
+		return nil, fmt.Errorf("%w: expected 8 or 9 fields, got %v", ErrInvalidFrame, len(fields))
+	}
+
+	frame = &Frame{
+		Raw: line,
+	}
+
+	if !decimalRegex.MatchString(fields[0]) {
+		return nil, fmt.Errorf("%w: rssi %q is not a 3 digit number", ErrInvalidFrame, fields[0])
+	}
+	frame.RSSI, _ = strconv.Atoi(fields[0])
+
+	switch Verb(fields[1]) {
+	case VerbInformation, VerbWrite, VerbRequest, VerbReply:
+		frame.Verb = Verb(fields[1])
+	default:
+		return nil, fmt.Errorf("%w: unknown verb %q", ErrInvalidFrame, fields[1])
+	}
+
+	switch {
+	case fields[2] == "---":
+		frame.Sequence = NoSequence
+	case decimalRegex.MatchString(fields[2]):
+		frame.Sequence, _ = strconv.Atoi(fields[2])
+	default:
+		return nil, fmt.Errorf("%w: sequence %q is not --- or a 3 digit number", ErrInvalidFrame, fields[2])
+	}
+
+	for i := range frame.Addresses {
+		address := fields[3+i]
+		switch {
+		case address == emptyAddress:
+			frame.Addresses[i] = ""
+		case addressRegex.MatchString(address):
+			frame.Addresses[i] = Address(address)
+		default:
+			return nil, fmt.Errorf("%w: address %v %q is not in the form 01:234567", ErrInvalidFrame, i, address)
+		}
+	}
+	if frame.Source().IsEmpty() {
+		return nil, fmt.Errorf("%w: frame has no source address", ErrInvalidFrame)
+	}
+
+	if !opcodeRegex.MatchString(fields[6]) {
+		return nil, fmt.Errorf("%w: opcode %q is not 4 hex digits", ErrInvalidFrame, fields[6])
+	}
+	frame.Opcode = Opcode(strings.ToUpper(fields[6]))
+
+	if !decimalRegex.MatchString(fields[7]) {
+		return nil, fmt.Errorf("%w: payload length %q is not a 3 digit number", ErrInvalidFrame, fields[7])
+	}
+	frame.Length, _ = strconv.Atoi(fields[7])
+
+	payload := ""
+	if len(fields) == 9 {
+		payload = fields[8]
+	}
+	frame.Payload, err = hex.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload %q is not valid hex: %v", ErrInvalidFrame, payload, err)
+	}
+	if len(frame.Payload) != frame.Length {
+		return nil, fmt.Errorf("%w: payload has %v bytes, but length says %v", ErrInvalidFrame, len(frame.Payload), frame.Length)
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFrame(t *testing.T) {
+
+	t.Run("ReturnsFrameForBroadcast", func(t *testing.T) {
+
+		// act
+		frame, err := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 45, frame.RSSI)
+		assert.Equal(t, VerbInformation, frame.Verb)
+		assert.Equal(t, NoSequence, frame.Sequence)
+		assert.Equal(t, [3]Address{"01:145038", "", "01:145038"}, frame.Addresses)
+		assert.Equal(t, Opcode("30C9"), frame.Opcode)
+		assert.Equal(t, 3, frame.Length)
+		assert.Equal(t, []byte{0x00, 0x07, 0xd0}, frame.Payload)
+		assert.Equal(t, Address("01:145038"), frame.Source())
+		assert.True(t, frame.Destination().IsEmpty())
+	})
+
+	t.Run("ReturnsFrameForRequestWithSequence", func(t *testing.T) {
+
+		// act
+		frame, err := ParseFrame("071 RQ 012 18:013393 01:145038 --:------ 2309 001 00\r\n")
+
+		assert.Nil(t, err)
+		assert.Equal(t, VerbRequest, frame.Verb)
+		assert.Equal(t, 12, frame.Sequence)
+		assert.Equal(t, Address("18:013393"), frame.Source())
+		assert.Equal(t, Address("01:145038"), frame.Destination())
+		assert.Equal(t, "18", frame.Source().DeviceType())
+		assert.Equal(t, "Gateway", frame.Source().DeviceTypeName())
+	})
+
+	t.Run("NormalizesOpcodeToUpperCase", func(t *testing.T) {
+
+		// act
+		frame, err := ParseFrame("045 RP --- 01:145038 18:013393 --:------ 3ef0 003 00c8ff")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Opcode("3EF0"), frame.Opcode)
+	})
+
+	t.Run("ReturnsErrorForFaultMarker", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0 * ERR")
+
+		assert.NotNil(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+		assert.Contains(t, err.Error(), "ERR")
+	})
+
+	t.Run("ReturnsErrorForBadMarker", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 003 0007D0_BAD")
+
+		assert.NotNil(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+		assert.Contains(t, err.Error(), "_BAD")
+	})
+
+	t.Run("ParsesPayloadContainingBadAsHex", func(t *testing.T) {
+
+		// act
+		frame, err := ParseFrame("045  I --- 34:092243 --:------ 34:092243 30C9 003 000BAD")
+
+		assert.Nil(t, err)
+		if assert.NotNil(t, frame) {
+			assert.Equal(t, []byte{0x00, 0x0B, 0xAD}, frame.Payload)
+		}
+	})
+
+	t.Run("ReturnsErrorForUnknownVerb", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045 XX --- 01:145038 --:------ 01:145038 30C9 003 0007D0")
+
+		assert.NotNil(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+		assert.Contains(t, err.Error(), "verb")
+	})
+
+	t.Run("ReturnsErrorForInvalidAddress", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045  I --- 01:14503 --:------ 01:145038 30C9 003 0007D0")
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "address 0")
+	})
+
+	t.Run("ReturnsErrorForLengthMismatch", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 006 0007D0")
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "length")
+	})
+
+	t.Run("ReturnsErrorForInvalidPayload", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 003 0007DZ")
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "hex")
+	})
+
+	t.Run("ReturnsErrorForTooFewFields", func(t *testing.T) {
+
+		// act
+		_, err := ParseFrame("# evofw3 0.7.0")
+
+		assert.NotNil(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+	})
+}
+
+func TestParseAddress(t *testing.T) {
+	t.Run("ReturnsAddress", func(t *testing.T) {
+
+		// act
+		address, err := ParseAddress("01:145038")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Address("01:145038"), address)
+	})
+
+	t.Run("ReturnsErrorForInvalidAddress", func(t *testing.T) {
+
+		// act
+		_, err := ParseAddress("01:14503")
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const OpcodeSystemMode Opcode = "2E04"
+
+// SystemMode is the mode of the whole system as set on the controller with opcode 2E04
+type SystemMode byte
+
+const (
+	SystemModeAuto          SystemMode = 0x00
+	SystemModeHeatOff       SystemMode = 0x01
+	SystemModeEco           SystemMode = 0x02
+	SystemModeAway          SystemMode = 0x03
+	SystemModeDayOff        SystemMode = 0x04
+	SystemModeDayOffEco     SystemMode = 0x05
+	SystemModeAutoWithReset SystemMode = 0x06
+	SystemModeCustom        SystemMode = 0x07
+)
+
+var systemModeNames = map[SystemMode]string{
+	SystemModeAuto:          "auto",
+	SystemModeHeatOff:       "heatOff",
+	SystemModeEco:           "eco",
+	SystemModeAway:          "away",
+	SystemModeDayOff:        "dayOff",
+	SystemModeDayOffEco:     "dayOffEco",
+	SystemModeAutoWithReset: "autoWithReset",
+	SystemModeCustom:        "custom",
+}
+
+func (m SystemMode) String() string {
+	if name, ok := systemModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown %02X", byte(m))
+}
+
+// ParseSystemMode returns the system mode for names like auto, eco or away
+func ParseSystemMode(name string) (SystemMode, error) {
+	for mode, modeName := range systemModeNames {
+		if strings.EqualFold(modeName, name) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("System mode %q is unknown, use one of auto, heatOff, eco, away, dayOff, dayOffEco, autoWithReset or custom", name)
+}
+
+// SystemModeState is the system mode with the time it lasts until as sent with opcode 2E04
+type SystemModeState struct {
+	Mode SystemMode
+	// Until is nil for a permanent mode and in local time of the controller
+	Until *time.Time
+}
+
+// DecodeSystemMode decodes an 8 byte 2E04 payload
+func DecodeSystemMode(frame *Frame) (state SystemModeState, err error) {
+	if frame.Opcode != OpcodeSystemMode {
+		return state, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeSystemMode)
+	}
+	if len(frame.Payload) != 8 {
+		return state, fmt.Errorf("Payload of %v bytes for opcode %v is not 8 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	state.Mode = SystemMode(frame.Payload[0])
+	if _, ok := systemModeNames[state.Mode]; !ok {
+		return state, fmt.Errorf("System mode %v for opcode %v is unknown", state.Mode, frame.Opcode)
+	}
+	state.Until = decodeDateTime(frame.Payload[1:7])
+
+	return state, nil
+}
+
+// EncodeSystemMode returns the 2E04 payload for setting the system mode permanently or, if until is set, temporarily
+func EncodeSystemMode(mode SystemMode, until *time.Time) []byte {
+	payload := []byte{byte(mode)}
+	if until == nil {
+		return append(append(payload, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF), 0x00)
+	}
+
+	return append(append(payload, encodeDateTime(*until)...), 0x01)
+}
+
+// encodeDateTime converts a time into 6 bytes with minute, hour, day, month and 2 byte year, the reverse of
+// decodeDateTime
+func encodeDateTime(dateTime time.Time) []byte {
+	dateTime = dateTime.In(time.Local)
+	return []byte{
+		byte(dateTime.Minute()),
+		byte(dateTime.Hour()),
+		byte(dateTime.Day()),
+		byte(dateTime.Month()),
+		byte(dateTime.Year() >> 8),
+		byte(dateTime.Year()),
+	}
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSystemMode(t *testing.T) {
+	t.Run("ReturnsPermanentMode", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2E04 008 02FFFFFFFFFFFF00")
+
+		// act
+		state, err := DecodeSystemMode(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, SystemModeEco, state.Mode)
+		assert.Nil(t, state.Until)
+	})
+
+	t.Run("ReturnsTemporaryMode", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2E04 008 031E160B0A07E401")
+
+		// act
+		state, err := DecodeSystemMode(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, SystemModeAway, state.Mode)
+		if assert.NotNil(t, state.Until) {
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 30, 0, 0, time.Local), *state.Until)
+		}
+	})
+
+	t.Run("ReturnsErrorForUnknownMode", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2E04 008 09FFFFFFFFFFFF00")
+
+		// act
+		_, err := DecodeSystemMode(frame)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestEncodeSystemMode(t *testing.T) {
+	t.Run("ReturnsPermanentMode", func(t *testing.T) {
+
+		// act
+		payload := EncodeSystemMode(SystemModeAuto, nil)
+
+		assert.Equal(t, []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}, payload)
+	})
+
+	t.Run("ReturnsTemporaryModeThatDecodesToSameValues", func(t *testing.T) {
+
+		until := time.Date(2020, time.October, 11, 22, 30, 0, 0, time.Local)
+
+		// act
+		payload := EncodeSystemMode(SystemModeAway, &until)
+
+		frame := NewFrame(VerbInformation, "01:145038", OpcodeSystemMode, payload)
+		state, err := DecodeSystemMode(frame)
+		assert.Nil(t, err)
+		assert.Equal(t, SystemModeAway, state.Mode)
+		assert.Equal(t, until, *state.Until)
+	})
+}
+
+func TestParseSystemMode(t *testing.T) {
+	t.Run("ReturnsModeIgnoringCase", func(t *testing.T) {
+
+		// act
+		mode, err := ParseSystemMode("heatoff")
+
+		assert.Nil(t, err)
+		assert.Equal(t, SystemModeHeatOff, mode)
+	})
+
+	t.Run("ReturnsErrorForUnknownName", func(t *testing.T) {
+
+		// act
+		_, err := ParseSystemMode("holiday")
+
+		assert.NotNil(t, err)
+	})
+}
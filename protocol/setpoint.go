@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+const (
+	OpcodeZoneSetpoint Opcode = "2309"
+	OpcodeZoneMode     Opcode = "2349"
+)
+
+// ZoneMode is the way a zone setpoint is controlled as sent with opcode 2349
+type ZoneMode int
+
+const (
+	ZoneModeFollowSchedule    ZoneMode = 0
+	ZoneModeAdvancedOverride  ZoneMode = 1
+	ZoneModePermanentOverride ZoneMode = 2
+	ZoneModeCountdownOverride ZoneMode = 3
+	ZoneModeTemporaryOverride ZoneMode = 4
+)
+
+// ZoneSetpoint is the target temperature of a single zone as sent with opcode 2309
+type ZoneSetpoint struct {
+	ZoneIndex int
+	Setpoint  float64
+	Available bool
+}
+
+// ZoneSetpointOverride is the setpoint and mode of a single zone as sent with opcode 2349
+type ZoneSetpointOverride struct {
+	ZoneIndex int
+	Setpoint  float64
+	Available bool
+	Mode      ZoneMode
+	// Countdown is set for ZoneModeCountdownOverride
+	Countdown time.Duration
+	// Until is set for ZoneModeTemporaryOverride and in local time of the controller
+	Until *time.Time
+}
+
+// DecodeZoneSetpoints decodes a single zone or multi-zone 2309 payload
+func DecodeZoneSetpoints(frame *Frame) (setpoints []ZoneSetpoint, err error) {
+	if frame.Opcode != OpcodeZoneSetpoint {
+		return nil, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeZoneSetpoint)
+	}
+	if len(frame.Payload) == 0 || len(frame.Payload)%3 != 0 {
+		return nil, fmt.Errorf("Payload of %v bytes for opcode %v is not a multiple of 3", len(frame.Payload), frame.Opcode)
+	}
+
+	for i := 0; i < len(frame.Payload); i += 3 {
+		setpoint, available := decodeTemperature(frame.Payload[i+1 : i+3])
+		setpoints = append(setpoints, ZoneSetpoint{
+			ZoneIndex: int(frame.Payload[i]),
+			Setpoint:  setpoint,
+			Available: available,
+		})
+	}
+
+	return setpoints, nil
+}
+
+// minimum and maximum setpoints a controller accepts
+const (
+	minSetpoint = 5
+	maxSetpoint = 35
+)
+
+// EncodeZoneSetpoint returns the 2309 payload for setting the setpoint of a zone
+func EncodeZoneSetpoint(zoneIndex int, setpoint float64) ([]byte, error) {
+	if zoneIndex < 0 || zoneIndex > 0xFF {
+		return nil, fmt.Errorf("Zone index %v is not between 0 and 255", zoneIndex)
+	}
+	if setpoint < minSetpoint || setpoint > maxSetpoint {
+		return nil, fmt.Errorf("Setpoint %v is not between %v and %v", setpoint, minSetpoint, maxSetpoint)
+	}
+
+	return append([]byte{byte(zoneIndex)}, encodeTemperature(setpoint)...), nil
+}
+
+// DecodeZoneSetpointOverride decodes a 2349 payload of 7 bytes, or 13 bytes if it includes an until time
+func DecodeZoneSetpointOverride(frame *Frame) (override ZoneSetpointOverride, err error) {
+	if frame.Opcode != OpcodeZoneMode {
+		return override, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeZoneMode)
+	}
+	if len(frame.Payload) != 7 && len(frame.Payload) != 13 {
+		return override, fmt.Errorf("Payload of %v bytes for opcode %v is not 7 or 13 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	override.ZoneIndex = int(frame.Payload[0])
+	override.Setpoint, override.Available = decodeTemperature(frame.Payload[1:3])
+	override.Mode = ZoneMode(frame.Payload[3])
+	if override.Mode < ZoneModeFollowSchedule || override.Mode > ZoneModeTemporaryOverride {
+		return override, fmt.Errorf("Zone mode %v for opcode %v is unknown", override.Mode, frame.Opcode)
+	}
+
+	// countdown in minutes
+	if countdown := frame.Payload[4:7]; !bytes.Equal(countdown, []byte{0xFF, 0xFF, 0xFF}) {
+		minutes := int(countdown[0])<<16 | int(countdown[1])<<8 | int(countdown[2])
+		override.Countdown = time.Duration(minutes) * time.Minute
+	}
+
+	if len(frame.Payload) == 13 {
+		override.Until = decodeDateTime(frame.Payload[7:13])
+	}
+
+	return override, nil
+}
+
+// decodeDateTime converts 6 bytes with minute, hour, day, month and 2 byte year into a time or nil if not set
+func decodeDateTime(data []byte) *time.Time {
+	if bytes.Equal(data, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		return nil
+	}
+
+	year := int(data[4])<<8 | int(data[5])
+	dateTime := time.Date(year, time.Month(data[3]), int(data[2]), int(data[1]&0x1F), int(data[0]), 0, 0, time.Local)
+
+	return &dateTime
+}
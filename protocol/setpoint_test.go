@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeZoneSetpoints(t *testing.T) {
+
+	t.Run("ReturnsSetpointsForMultipleZones", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2309 006 0007D00107E4")
+
+		// act
+		setpoints, err := DecodeZoneSetpoints(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []ZoneSetpoint{{ZoneIndex: 0, Setpoint: 20, Available: true}, {ZoneIndex: 1, Setpoint: 20.2, Available: true}}, setpoints)
+	})
+
+	t.Run("ReturnsErrorForRequestPayload", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RQ --- 18:013393 01:145038 --:------ 2309 001 00")
+
+		// act
+		_, err := DecodeZoneSetpoints(frame)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDecodeZoneSetpointOverride(t *testing.T) {
+
+	t.Run("ReturnsFollowScheduleOverride", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RP --- 01:145038 18:013393 --:------ 2349 007 0107D000FFFFFF")
+
+		// act
+		override, err := DecodeZoneSetpointOverride(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, override.ZoneIndex)
+		assert.Equal(t, 20.0, override.Setpoint)
+		assert.True(t, override.Available)
+		assert.Equal(t, ZoneModeFollowSchedule, override.Mode)
+		assert.Equal(t, time.Duration(0), override.Countdown)
+		assert.Nil(t, override.Until)
+	})
+
+	t.Run("ReturnsTemporaryOverrideWithUntilTime", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2349 013 02076C04FFFFFF1E160B0A07E4")
+
+		// act
+		override, err := DecodeZoneSetpointOverride(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, override.ZoneIndex)
+		assert.Equal(t, 19.0, override.Setpoint)
+		assert.Equal(t, ZoneModeTemporaryOverride, override.Mode)
+		if assert.NotNil(t, override.Until) {
+			assert.Equal(t, time.Date(2020, time.October, 11, 22, 30, 0, 0, time.Local), *override.Until)
+		}
+	})
+
+	t.Run("ReturnsCountdownOverride", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2349 007 0008340300003C")
+
+		// act
+		override, err := DecodeZoneSetpointOverride(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 21.0, override.Setpoint)
+		assert.Equal(t, ZoneModeCountdownOverride, override.Mode)
+		assert.Equal(t, time.Hour, override.Countdown)
+	})
+
+	t.Run("ReturnsErrorForUnknownMode", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2349 007 0007D009FFFFFF")
+
+		// act
+		_, err := DecodeZoneSetpointOverride(frame)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestEncodeZoneSetpoint(t *testing.T) {
+	t.Run("ReturnsPayloadInHundredthsOfADegree", func(t *testing.T) {
+
+		// act
+		payload, err := EncodeZoneSetpoint(2, 19.5)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x02, 0x07, 0x9E}, payload)
+	})
+
+	t.Run("ReturnsErrorForSetpointOutOfRange", func(t *testing.T) {
+
+		// act
+		_, err := EncodeZoneSetpoint(2, 40)
+
+		assert.NotNil(t, err)
+	})
+}
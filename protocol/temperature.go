@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const OpcodeZoneTemperature Opcode = "30C9"
+
+// temperatureUnavailable is sent instead of a temperature when a sensor has no valid reading
+const temperatureUnavailable = 0x7FFF
+
+// ZoneTemperature is the measured temperature of a single zone as broadcast with opcode 30C9
+type ZoneTemperature struct {
+	ZoneIndex   int
+	Temperature float64
+	Available   bool
+}
+
+// DecodeZoneTemperatures decodes a single zone or multi-zone 30C9 payload
+func DecodeZoneTemperatures(frame *Frame) (temperatures []ZoneTemperature, err error) {
+	if frame.Opcode != OpcodeZoneTemperature {
+		return nil, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeZoneTemperature)
+	}
+	if len(frame.Payload) == 0 || len(frame.Payload)%3 != 0 {
+		return nil, fmt.Errorf("Payload of %v bytes for opcode %v is not a multiple of 3", len(frame.Payload), frame.Opcode)
+	}
+
+	for i := 0; i < len(frame.Payload); i += 3 {
+		temperature, available := decodeTemperature(frame.Payload[i+1 : i+3])
+		temperatures = append(temperatures, ZoneTemperature{
+			ZoneIndex:   int(frame.Payload[i]),
+			Temperature: temperature,
+			Available:   available,
+		})
+	}
+
+	return temperatures, nil
+}
+
+// decodeTemperature converts 2 bytes in hundredths of a degree Celsius into degrees Celsius
+func decodeTemperature(data []byte) (temperature float64, available bool) {
+	value := binary.BigEndian.Uint16(data)
+	if value == temperatureUnavailable {
+		return 0, false
+	}
+
+	return float64(int16(value)) / 100, true
+}
+
+// encodeTemperature converts degrees Celsius into 2 bytes in hundredths of a degree Celsius
+func encodeTemperature(temperature float64) []byte {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(int16(math.Round(temperature*100))))
+
+	return data
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeZoneTemperatures(t *testing.T) {
+
+	t.Run("ReturnsTemperatureForSingleZone", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		// act
+		temperatures, err := DecodeZoneTemperatures(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []ZoneTemperature{{ZoneIndex: 0, Temperature: 20, Available: true}}, temperatures)
+	})
+
+	t.Run("ReturnsTemperaturesForMultipleZones", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 009 0007D00108CA02FF9C")
+
+		// act
+		temperatures, err := DecodeZoneTemperatures(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(temperatures))
+		assert.Equal(t, ZoneTemperature{ZoneIndex: 1, Temperature: 22.5, Available: true}, temperatures[1])
+		assert.Equal(t, ZoneTemperature{ZoneIndex: 2, Temperature: -1, Available: true}, temperatures[2])
+	})
+
+	t.Run("ReturnsUnavailableForSentinel", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 30C9 006 0007D0037FFF")
+
+		// act
+		temperatures, err := DecodeZoneTemperatures(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, ZoneTemperature{ZoneIndex: 3, Available: false}, temperatures[1])
+	})
+
+	t.Run("ReturnsErrorForRequestPayload", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045 RQ --- 18:013393 01:145038 --:------ 30C9 001 00")
+
+		// act
+		_, err := DecodeZoneTemperatures(frame)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForOtherOpcode", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 01:145038 --:------ 01:145038 2309 003 0007D0")
+
+		// act
+		_, err := DecodeZoneTemperatures(frame)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,196 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UponorAddressPrefix starts the address of Uponor Smatrix Wave devices, which is followed by the system and device
+// address in hex like uponor:110B:DE13
+const UponorAddressPrefix = "uponor:"
+
+// OpcodeUponor counts Uponor Smatrix Wave frames next to the RAMSES-II opcodes, as they have no opcode of their own
+const OpcodeUponor Opcode = "UPONOR"
+
+// UponorDataID identifies a value in an Uponor Smatrix Wave frame
+type UponorDataID byte
+
+const (
+	UponorDataIDSetpoint         UponorDataID = 0x3B
+	UponorDataIDDemand           UponorDataID = 0x3D
+	UponorDataIDRoomTemperature  UponorDataID = 0x40
+	UponorDataIDFloorTemperature UponorDataID = 0x41
+	UponorDataIDHumidity         UponorDataID = 0x42
+)
+
+const (
+	// uponorDemandHeating is set in the demand value while the thermostat calls for heat
+	uponorDemandHeating = 0x0040
+	// the thermostats send these instead of a temperature when a sensor isn't fitted or has no valid reading
+	uponorTemperatureUnavailable  = 0x7FFF
+	uponorTemperatureDisconnected = 0xFFFF
+)
+
+// UponorValue is a single data id with its 16 bit value
+type UponorValue struct {
+	ID    UponorDataID
+	Value uint16
+}
+
+// UponorFrame is a frame sent by an Uponor Smatrix Wave thermostat such as the T-165, T-166 or T-169, which the
+// antenna passes on as a hex line like '045 110BDE13400320...' instead of a RAMSES-II line
+type UponorFrame struct {
+	Raw    string
+	RSSI   int
+	System uint16
+	Device uint16
+	Values []UponorValue
+}
+
+// Address returns the address of the thermostat that sent the frame
+func (f *UponorFrame) Address() Address {
+	return Address(fmt.Sprintf("%v%04X:%04X", UponorAddressPrefix, f.System, f.Device))
+}
+
+// IsUponor returns true for addresses of Uponor Smatrix Wave devices
+func (a Address) IsUponor() bool {
+	return strings.HasPrefix(string(a), UponorAddressPrefix)
+}
+
+var uponorAddressRegex = regexp.MustCompile(`^uponor:([0-9A-F]{4}):([0-9A-F]{4})$`)
+
+// ParseUponorAddress checks that an address is in the form uponor:110B:DE13
+func ParseUponorAddress(address string) (Address, error) {
+	if !uponorAddressRegex.MatchString(address) {
+		return "", fmt.Errorf("Address %q is not in the form uponor:110B:DE13", address)
+	}
+	return Address(address), nil
+}
+
+// UponorSystem returns the system address shared by the thermostats of a single Uponor Smatrix Wave installation, or
+// false if the address isn't an Uponor address
+func (a Address) UponorSystem() (system uint16, ok bool) {
+	match := uponorAddressRegex.FindStringSubmatch(string(a))
+	if match == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(match[1], 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+// ParseUponorFrame parses a line with an optional 3 digit rssi and the frame bytes in hex, which are the 2 byte system
+// address, the 2 byte device address, 3 bytes per value and a modbus crc16
+func ParseUponorFrame(line string) (frame *UponorFrame, err error) {
+
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Fields(line)
+
+	frame = &UponorFrame{
+		Raw: line,
+	}
+
+	switch len(fields) {
+	case 1:
+	case 2:
+		if !decimalRegex.MatchString(fields[0]) {
+			return nil, fmt.Errorf("%w: rssi %q is not a 3 digit number", ErrInvalidFrame, fields[0])
+		}
+		frame.RSSI, _ = strconv.Atoi(fields[0])
+	default:
+		return nil, fmt.Errorf("%w: expected 1 or 2 fields for an uponor frame, got %v", ErrInvalidFrame, len(fields))
+	}
+
+	data, err := hex.DecodeString(fields[len(fields)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: uponor frame %q is not valid hex: %v", ErrInvalidFrame, fields[len(fields)-1], err)
+	}
+	if len(data) < 9 || (len(data)-6)%3 != 0 {
+		return nil, fmt.Errorf("%w: uponor frame of %v bytes has no whole values", ErrInvalidFrame, len(data))
+	}
+
+	body, checksum := data[:len(data)-2], binary.LittleEndian.Uint16(data[len(data)-2:])
+	if crc := crc16Modbus(body); crc != checksum {
+		return nil, fmt.Errorf("%w: uponor frame has crc %04X, but checksum says %04X", ErrInvalidFrame, crc, checksum)
+	}
+
+	frame.System = binary.BigEndian.Uint16(body[0:2])
+	frame.Device = binary.BigEndian.Uint16(body[2:4])
+	for i := 4; i < len(body); i += 3 {
+		frame.Values = append(frame.Values, UponorValue{
+			ID:    UponorDataID(body[i]),
+			Value: binary.BigEndian.Uint16(body[i+1 : i+3]),
+		})
+	}
+
+	return frame, nil
+}
+
+// UponorThermostat holds the values of an Uponor Smatrix Wave frame; a frame only carries some of them, so the others
+// are nil
+type UponorThermostat struct {
+	RoomTemperature  *float64
+	Setpoint         *float64
+	FloorTemperature *float64
+	// Humidity is in percent and only sent by T-169 variants with humidity sensor
+	Humidity *float64
+	// Demand is true while the thermostat calls for heat
+	Demand *bool
+}
+
+// DecodeUponorThermostat decodes the values of an Uponor Smatrix Wave frame
+func DecodeUponorThermostat(frame *UponorFrame) (thermostat UponorThermostat) {
+	for _, v := range frame.Values {
+		switch v.ID {
+		case UponorDataIDRoomTemperature:
+			thermostat.RoomTemperature = decodeUponorTemperature(v.Value)
+		case UponorDataIDSetpoint:
+			thermostat.Setpoint = decodeUponorTemperature(v.Value)
+		case UponorDataIDFloorTemperature:
+			thermostat.FloorTemperature = decodeUponorTemperature(v.Value)
+		case UponorDataIDHumidity:
+			humidity := float64(v.Value & 0xFF)
+			thermostat.Humidity = &humidity
+		case UponorDataIDDemand:
+			demand := v.Value&uponorDemandHeating != 0
+			thermostat.Demand = &demand
+		}
+	}
+
+	return thermostat
+}
+
+// decodeUponorTemperature converts tenths of a degree Fahrenheit into degrees Celsius, rounded to hundredths
+func decodeUponorTemperature(value uint16) *float64 {
+	if value == uponorTemperatureUnavailable || value == uponorTemperatureDisconnected {
+		return nil
+	}
+
+	celsius := math.Round((float64(value)/10-32)/1.8*100) / 100
+
+	return &celsius
+}
+
+// crc16Modbus returns the crc16 with polynomial 0xA001 and initial value 0xFFFF that ends the uponor frames
+func crc16Modbus(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUponorFrame(t *testing.T) {
+	t.Run("ReturnsFrameWithValues", func(t *testing.T) {
+
+		// act
+		frame, err := ParseUponorFrame("045 110BDE134002B13B02BA41030242002D3D00406438\r\n")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 45, frame.RSSI)
+		assert.Equal(t, Address("uponor:110B:DE13"), frame.Address())
+		assert.Equal(t, 5, len(frame.Values))
+		assert.Equal(t, UponorValue{ID: UponorDataIDRoomTemperature, Value: 0x02B1}, frame.Values[0])
+	})
+
+	t.Run("ReturnsFrameWithoutRSSI", func(t *testing.T) {
+
+		// act
+		frame, err := ParseUponorFrame("110BDE13407FFFD649")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, frame.RSSI)
+		assert.Equal(t, 1, len(frame.Values))
+	})
+
+	t.Run("ReturnsErrorForInvalidChecksum", func(t *testing.T) {
+
+		// act
+		_, err := ParseUponorFrame("045 110BDE134002B13B02BA41030242002D3D00406439")
+
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+	})
+
+	t.Run("ReturnsErrorForRAMSESLine", func(t *testing.T) {
+
+		// act
+		_, err := ParseUponorFrame("045  I --- 34:092243 --:------ 34:092243 30C9 003 0007D0")
+
+		assert.True(t, errors.Is(err, ErrInvalidFrame))
+	})
+}
+
+func TestDecodeUponorThermostat(t *testing.T) {
+	t.Run("ReturnsValuesInCelsius", func(t *testing.T) {
+
+		frame, _ := ParseUponorFrame("045 110BDE134002B13B02BA41030242002D3D00406438")
+
+		// act
+		thermostat := DecodeUponorThermostat(frame)
+
+		if assert.NotNil(t, thermostat.RoomTemperature) {
+			assert.Equal(t, 20.5, *thermostat.RoomTemperature)
+		}
+		if assert.NotNil(t, thermostat.Setpoint) {
+			assert.Equal(t, 21.0, *thermostat.Setpoint)
+		}
+		if assert.NotNil(t, thermostat.FloorTemperature) {
+			assert.Equal(t, 25.0, *thermostat.FloorTemperature)
+		}
+		if assert.NotNil(t, thermostat.Humidity) {
+			assert.Equal(t, 45.0, *thermostat.Humidity)
+		}
+		if assert.NotNil(t, thermostat.Demand) {
+			assert.True(t, *thermostat.Demand)
+		}
+	})
+
+	t.Run("ReturnsNilForUnavailableTemperature", func(t *testing.T) {
+
+		frame, _ := ParseUponorFrame("110BDE13407FFFD649")
+
+		// act
+		thermostat := DecodeUponorThermostat(frame)
+
+		assert.Nil(t, thermostat.RoomTemperature)
+		assert.Nil(t, thermostat.Setpoint)
+	})
+}
+
+func TestParseUponorAddress(t *testing.T) {
+	t.Run("ReturnsAddressWithSystem", func(t *testing.T) {
+
+		// act
+		address, err := ParseUponorAddress("uponor:110B:DE13")
+
+		assert.Nil(t, err)
+		system, ok := address.UponorSystem()
+		assert.True(t, ok)
+		assert.Equal(t, uint16(0x110B), system)
+	})
+
+	t.Run("ReturnsErrorForInvalidAddress", func(t *testing.T) {
+
+		// act
+		_, err := ParseUponorAddress("uponor:110B")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsNoSystemForRamsesAddress", func(t *testing.T) {
+
+		// act
+		_, ok := Address("34:092243").UponorSystem()
+
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+const OpcodeWindowState Opcode = "12B0"
+
+// WindowState is the open window state of a zone as sent with opcode 12B0 by thermostats and radiator valves with
+// window detection
+type WindowState struct {
+	ZoneIndex int
+	Open      bool
+	Available bool
+}
+
+// DecodeWindowState decodes a 3 byte 12B0 payload
+func DecodeWindowState(frame *Frame) (state WindowState, err error) {
+	if frame.Opcode != OpcodeWindowState {
+		return state, fmt.Errorf("Opcode %v is not %v", frame.Opcode, OpcodeWindowState)
+	}
+	if len(frame.Payload) != 3 {
+		return state, fmt.Errorf("Payload of %v bytes for opcode %v is not 3 bytes", len(frame.Payload), frame.Opcode)
+	}
+
+	state.ZoneIndex = int(frame.Payload[0])
+	switch frame.Payload[1] {
+	case 0x00:
+		state.Available = true
+	case 0xC8:
+		state.Open = true
+		state.Available = true
+	}
+
+	return state, nil
+}
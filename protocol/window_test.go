@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeWindowState(t *testing.T) {
+	t.Run("ReturnsOpenWindow", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:056057 --:------ 04:056057 12B0 003 02C800")
+
+		// act
+		state, err := DecodeWindowState(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, WindowState{ZoneIndex: 2, Open: true, Available: true}, state)
+	})
+
+	t.Run("ReturnsClosedWindow", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:056057 --:------ 04:056057 12B0 003 020000")
+
+		// act
+		state, err := DecodeWindowState(frame)
+
+		assert.Nil(t, err)
+		assert.Equal(t, WindowState{ZoneIndex: 2, Open: false, Available: true}, state)
+	})
+
+	t.Run("ReturnsUnavailableForUnknownState", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:056057 --:------ 04:056057 12B0 003 02FF00")
+
+		// act
+		state, err := DecodeWindowState(frame)
+
+		assert.Nil(t, err)
+		assert.False(t, state.Available)
+	})
+
+	t.Run("ReturnsErrorForInvalidLength", func(t *testing.T) {
+
+		frame, _ := ParseFrame("045  I --- 04:056057 --:------ 04:056057 12B0 002 0200")
+
+		// act
+		_, err := DecodeWindowState(frame)
+
+		assert.NotNil(t, err)
+	})
+}